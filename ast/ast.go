@@ -1,8 +1,11 @@
-package main
+package ast
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+
+	"toyscript/lexer"
 )
 
 type (
@@ -25,6 +28,9 @@ type (
 		VisitSeq(n *SeqExpression) any
 		VisitChain(n *ChainExpression) any
 		VisitAsync(n *AsyncExpression) any
+		VisitLogical(n *LogicalExpression) any
+		VisitTry(n *TryExpression) any
+		VisitSelect(n *SelectExpression) any
 	}
 
 	Value = any
@@ -33,86 +39,183 @@ type (
 		Accept(v ExpressionVisitor) any
 		Type() string
 		String() string
+		Loc() lexer.Span
 	}
 
 	StringLiteral struct {
+		lexer.Span
 		Value string
 	}
 
+	// Number is either an int or a float64
+	Number = any
+
 	NumberLiteral struct {
-		Value int
+		lexer.Span
+		Value Number
 	}
 
 	BooleanLiteral struct {
+		lexer.Span
 		Value bool
 	}
 
 	ListLiteral struct {
+		lexer.Span
 		Elements []Node
 	}
 
 	HashLiteral struct {
-		Elements map[string]Node
+		lexer.Span
+		Elements []HashEntry
 	}
 
+	HashEntry struct {
+		Key   string
+		Value Node
+	}
+
+	// StreamLiteral is (@stream (@capacity n) values...),
+	// Capacity is nil when the clause is left out
 	StreamLiteral struct {
-		Channal chan Node
+		lexer.Span
+		Capacity Node
+		Values   []Node
 	}
 
+	// FuncLiteral is a (@func (params...) (body...)),
+	// ParamSpans holds the span of every param name
 	FuncLiteral struct {
-		Params []string
-		Body   []Node
+		lexer.Span
+		Params     []string
+		ParamSpans []lexer.Span
+		Body       []Node
 	}
 
 	ProgramStatement struct {
+		lexer.Span
 		Body []Node
 	}
 
 	VarStatement struct {
-		Vars map[string]Node
+		lexer.Span
+		Vars []VarBinding
+	}
+
+	// VarBinding is a single (name value) pair,
+	// bindings are evaluated in order so later ones can use earlier ones.
+	// The Span covers the pair and NameSpan the name alone
+	VarBinding struct {
+		lexer.Span
+		Name     string
+		NameSpan lexer.Span
+		Value    Node
 	}
 
+	// ImportStatement maps aliases to module paths,
+	// AliasSpans holds the span of every alias
 	ImportStatement struct {
-		Imports map[string]string
+		lexer.Span
+		Imports    map[string]string
+		AliasSpans map[string]lexer.Span
 	}
 
 	ExportStatement struct {
+		lexer.Span
 		Exports []Node
 	}
 
 	ReferenceType = string
 
 	ReferenceExpression struct {
+		lexer.Span
 		RefName string
 		RefType ReferenceType
 	}
 
 	CallExpression struct {
+		lexer.Span
 		Callee Node
 		Args   []Node
 	}
 
 	MatchExpression struct {
+		lexer.Span
 		Cond  Node
-		Cases map[Node]Node
+		Cases []MatchCase
+	}
+
+	// MatchCase is a single (@when matcher action) clause,
+	// the first matching clause wins
+	MatchCase struct {
+		When Node
+		Then Node
 	}
 
 	MalformedExpression struct {
+		lexer.Span
 		Body  Value
 		Error error
 	}
 
 	SeqExpression struct {
+		lexer.Span
 		Expressions []Node
 	}
 
 	ChainExpression struct {
+		lexer.Span
 		Expressions []Node
 	}
 
+	// AsyncExpression evaluates every expression concurrently,
+	// Ordered sends the results in the order of the expressions instead of as they complete
 	AsyncExpression struct {
+		lexer.Span
+		Ordered     bool
 		Expressions []Node
 	}
+
+	// LogicalExpression is an @and or an @or,
+	// operands are evaluated lazily to allow short-circuiting
+	LogicalExpression struct {
+		lexer.Span
+		Operator string
+		Operands []Node
+	}
+
+	// TryExpression evaluates Body and, if it raises an error,
+	// evaluates Handler with the error bound to ErrName
+	TryExpression struct {
+		lexer.Span
+		Body    Node
+		ErrName string
+		ErrSpan lexer.Span
+		Handler Node
+	}
+
+	// SelectExpression waits for the first of its streams to have a value
+	// and evaluates the Then of its case with the value bound to value.
+	// Default and Timeout are nil when they are left out
+	SelectExpression struct {
+		lexer.Span
+		Cases   []SelectCase
+		Default Node
+		Timeout *SelectTimeout
+	}
+
+	// SelectCase is a single (@when stream then) clause
+	SelectCase struct {
+		Stream Node
+		Then   Node
+	}
+
+	// SelectTimeout is the (@timeout ms then) clause,
+	// evaluated when no stream had a value for After milliseconds
+	SelectTimeout struct {
+		After Node
+		Then  Node
+	}
 )
 
 const (
@@ -138,7 +241,7 @@ func (n *NumberLiteral) Type() string {
 }
 
 func (n *NumberLiteral) String() string {
-	return fmt.Sprintf("%d", n.Value)
+	return FormatNumber(n.Value)
 }
 
 func (n *NumberLiteral) Accept(v ExpressionVisitor) any {
@@ -190,8 +293,8 @@ func (n *HashLiteral) String() string {
 	str := strings.Builder{}
 	str.WriteString(":HASH (\n")
 
-	for key, el := range n.Elements {
-		str.WriteString("KEY: " + key + " VALUE: " + el.String() + "\n")
+	for _, el := range n.Elements {
+		str.WriteString("KEY: " + el.Key + " VALUE: " + el.Value.String() + "\n")
 	}
 
 	str.WriteString(")")
@@ -208,8 +311,20 @@ func (n *StreamLiteral) Type() string {
 }
 
 func (n *StreamLiteral) String() string {
-	// TODO:
-	return ""
+	str := strings.Builder{}
+	str.WriteString(":STREAM (\n")
+
+	if n.Capacity != nil {
+		str.WriteString("CAPACITY: " + n.Capacity.String() + "\n")
+	}
+
+	for _, el := range n.Values {
+		str.WriteString(el.String() + "\n")
+	}
+
+	str.WriteString(")")
+
+	return str.String()
 }
 
 func (n *StreamLiteral) Accept(v ExpressionVisitor) any {
@@ -268,8 +383,8 @@ func (n *VarStatement) String() string {
 	str := strings.Builder{}
 	str.WriteString(":VAR (\n")
 
-	for key, el := range n.Vars {
-		str.WriteString("NAME: " + key + " VALUE: " + el.String() + "\n\n")
+	for _, el := range n.Vars {
+		str.WriteString("NAME: " + el.Name + " VALUE: " + el.Value.String() + "\n\n")
 	}
 
 	str.WriteString(")")
@@ -350,8 +465,8 @@ func (n *MatchExpression) String() string {
 	str.WriteString(" :MATCH (\n")
 	str.WriteString("  :COND (" + n.Cond.String() + ")\n")
 
-	for w, a := range n.Cases {
-		str.WriteString(":WHEN ( " + w.String() + " " + a.String() + ")\n")
+	for _, c := range n.Cases {
+		str.WriteString(":WHEN ( " + c.When.String() + " " + c.Then.String() + ")\n")
 	}
 
 	str.WriteString(")")
@@ -437,6 +552,10 @@ func (n *AsyncExpression) String() string {
 
 	str.WriteString(":ASYNC (\n")
 
+	if n.Ordered {
+		str.WriteString("  :ORDERED\n")
+	}
+
 	for _, expr := range n.Expressions {
 		str.WriteString("  " + expr.String() + "\n")
 	}
@@ -449,3 +568,90 @@ func (n *AsyncExpression) String() string {
 func (n *AsyncExpression) Accept(v ExpressionVisitor) any {
 	return v.VisitAsync(n)
 }
+
+func (n *LogicalExpression) Type() string {
+	return "LogicalExpression"
+}
+
+func (n *LogicalExpression) String() string {
+	str := strings.Builder{}
+
+	str.WriteString(":" + strings.ToUpper(strings.TrimPrefix(n.Operator, "@")) + " (\n")
+
+	for _, expr := range n.Operands {
+		str.WriteString("  " + expr.String() + "\n")
+	}
+
+	str.WriteString(")")
+
+	return str.String()
+}
+
+func (n *LogicalExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitLogical(n)
+}
+
+func (n *TryExpression) Type() string {
+	return "TryExpression"
+}
+
+func (n *TryExpression) String() string {
+	str := strings.Builder{}
+
+	str.WriteString(":TRY (\n")
+	str.WriteString("  " + n.Body.String() + "\n")
+	str.WriteString("  :CATCH " + n.ErrName + " (" + n.Handler.String() + ")\n")
+	str.WriteString(")")
+
+	return str.String()
+}
+
+func (n *TryExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitTry(n)
+}
+
+func (n *SelectExpression) Type() string {
+	return "SelectExpression"
+}
+
+func (n *SelectExpression) String() string {
+	str := strings.Builder{}
+	str.WriteString(":SELECT (\n")
+
+	for _, c := range n.Cases {
+		str.WriteString(":WHEN ( " + c.Stream.String() + " " + c.Then.String() + ")\n")
+	}
+
+	if n.Default != nil {
+		str.WriteString(":DEFAULT ( " + n.Default.String() + ")\n")
+	}
+
+	if n.Timeout != nil {
+		str.WriteString(":TIMEOUT ( " + n.Timeout.After.String() + " " + n.Timeout.Then.String() + ")\n")
+	}
+
+	str.WriteString(")")
+	return str.String()
+}
+
+func (n *SelectExpression) Accept(v ExpressionVisitor) any {
+	return v.VisitSelect(n)
+}
+
+// FormatNumber renders an int or a float64 the way number literals are written
+func FormatNumber(v any) string {
+	switch n := v.(type) {
+	case int:
+		return strconv.Itoa(n)
+	case float64:
+		str := strconv.FormatFloat(n, 'g', -1, 64)
+		// NOTE: keep whole floats apart from ints, 7.0 must not read back as 7
+		if !strings.ContainsAny(str, ".eIN") {
+			str += ".0"
+		}
+
+		return str
+	}
+
+	return "NaN"
+}
@@ -0,0 +1,162 @@
+package ast
+
+import (
+	"maps"
+	"slices"
+
+	"toyscript/lexer"
+)
+
+type (
+	// jsonNode is the JSON object of a single node, keys are sorted when encoded
+	jsonNode = map[string]any
+
+	// astDumper converts nodes into JSON objects with their type and span
+	astDumper struct{}
+)
+
+// ASTJSON converts the node and its children into JSON objects
+func ASTJSON(n Node) jsonNode {
+	return n.Accept(astDumper{}).(jsonNode)
+}
+
+func (d astDumper) node(n Node, fields jsonNode) jsonNode {
+	fields["type"] = n.Type()
+	fields["span"] = n.Loc()
+	return fields
+}
+
+func (d astDumper) nodes(ns []Node) []jsonNode {
+	out := []jsonNode{}
+	for _, n := range ns {
+		out = append(out, n.Accept(d).(jsonNode))
+	}
+	return out
+}
+
+func (d astDumper) VisitString(n *StringLiteral) any {
+	return d.node(n, jsonNode{"value": n.Value})
+}
+
+func (d astDumper) VisitNumber(n *NumberLiteral) any {
+	// NOTE: 1.0 is encoded as 1, the kind keeps ints and floats apart
+	kind := "int"
+	if _, isFloat := n.Value.(float64); isFloat {
+		kind = "float"
+	}
+	return d.node(n, jsonNode{"value": n.Value, "kind": kind})
+}
+
+func (d astDumper) VisitBoolean(n *BooleanLiteral) any {
+	return d.node(n, jsonNode{"value": n.Value})
+}
+
+func (d astDumper) VisitList(n *ListLiteral) any {
+	return d.node(n, jsonNode{"elements": d.nodes(n.Elements)})
+}
+
+func (d astDumper) VisitHash(n *HashLiteral) any {
+	entries := []jsonNode{}
+	for _, el := range n.Elements {
+		entries = append(entries, jsonNode{"key": el.Key, "value": el.Value.Accept(d)})
+	}
+	return d.node(n, jsonNode{"entries": entries})
+}
+
+func (d astDumper) VisitStream(n *StreamLiteral) any {
+	fields := jsonNode{"values": d.nodes(n.Values)}
+	if n.Capacity != nil {
+		fields["capacity"] = n.Capacity.Accept(d)
+	}
+	return d.node(n, fields)
+}
+
+func (d astDumper) VisitFunc(n *FuncLiteral) any {
+	params := append([]string{}, n.Params...)
+	paramSpans := append([]lexer.Span{}, n.ParamSpans...)
+	return d.node(n, jsonNode{"params": params, "paramSpans": paramSpans, "body": d.nodes(n.Body)})
+}
+
+func (d astDumper) VisitProgram(n *ProgramStatement) any {
+	return d.node(n, jsonNode{"body": d.nodes(n.Body)})
+}
+
+func (d astDumper) VisitVar(n *VarStatement) any {
+	vars := []jsonNode{}
+	for _, b := range n.Vars {
+		vars = append(vars, jsonNode{"name": b.Name, "span": b.Span, "nameSpan": b.NameSpan, "value": b.Value.Accept(d)})
+	}
+	return d.node(n, jsonNode{"vars": vars})
+}
+
+func (d astDumper) VisitImport(n *ImportStatement) any {
+	imports := []jsonNode{}
+	for _, alias := range slices.Sorted(maps.Keys(n.Imports)) {
+		imports = append(imports, jsonNode{"alias": alias, "aliasSpan": n.AliasSpans[alias], "path": n.Imports[alias]})
+	}
+	return d.node(n, jsonNode{"imports": imports})
+}
+
+func (d astDumper) VisitExport(n *ExportStatement) any {
+	return d.node(n, jsonNode{"exports": d.nodes(n.Exports)})
+}
+
+func (d astDumper) VisitRef(n *ReferenceExpression) any {
+	return d.node(n, jsonNode{"name": n.RefName, "refType": n.RefType})
+}
+
+func (d astDumper) VisitCall(n *CallExpression) any {
+	return d.node(n, jsonNode{"callee": n.Callee.Accept(d), "args": d.nodes(n.Args)})
+}
+
+func (d astDumper) VisitMatch(n *MatchExpression) any {
+	cases := []jsonNode{}
+	for _, c := range n.Cases {
+		cases = append(cases, jsonNode{"when": c.When.Accept(d), "then": c.Then.Accept(d)})
+	}
+	return d.node(n, jsonNode{"cond": n.Cond.Accept(d), "cases": cases})
+}
+
+func (d astDumper) VisitMalformed(n *MalformedExpression) any {
+	msg := ""
+	if n.Error != nil {
+		msg = n.Error.Error()
+	}
+	return d.node(n, jsonNode{"error": msg})
+}
+
+func (d astDumper) VisitSeq(n *SeqExpression) any {
+	return d.node(n, jsonNode{"expressions": d.nodes(n.Expressions)})
+}
+
+func (d astDumper) VisitChain(n *ChainExpression) any {
+	return d.node(n, jsonNode{"expressions": d.nodes(n.Expressions)})
+}
+
+func (d astDumper) VisitAsync(n *AsyncExpression) any {
+	return d.node(n, jsonNode{"ordered": n.Ordered, "expressions": d.nodes(n.Expressions)})
+}
+
+func (d astDumper) VisitLogical(n *LogicalExpression) any {
+	return d.node(n, jsonNode{"operator": n.Operator, "operands": d.nodes(n.Operands)})
+}
+
+func (d astDumper) VisitTry(n *TryExpression) any {
+	return d.node(n, jsonNode{"body": n.Body.Accept(d), "errName": n.ErrName, "errSpan": n.ErrSpan, "handler": n.Handler.Accept(d)})
+}
+
+func (d astDumper) VisitSelect(n *SelectExpression) any {
+	cases := []jsonNode{}
+	for _, c := range n.Cases {
+		cases = append(cases, jsonNode{"stream": c.Stream.Accept(d), "then": c.Then.Accept(d)})
+	}
+
+	fields := jsonNode{"cases": cases}
+	if n.Default != nil {
+		fields["default"] = n.Default.Accept(d)
+	}
+	if n.Timeout != nil {
+		fields["timeout"] = jsonNode{"after": n.Timeout.After.Accept(d), "then": n.Timeout.Then.Accept(d)}
+	}
+	return d.node(n, fields)
+}
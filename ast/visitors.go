@@ -0,0 +1,540 @@
+package ast
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// NOTE: visitors shipped with the parser, so tools don't have to
+// re-implement the walk over the AST
+
+type (
+	// astPrinter renders nodes back into toy-script source,
+	// a form which doesn't fit on a line puts each of its parts on its own line
+	astPrinter struct {
+		indent int
+	}
+
+	// nodeCounter counts the visited nodes by their type
+	nodeCounter struct {
+		counts map[string]int
+	}
+
+	// freeVarAnalyser collects the declared refs that are not bound
+	// by an enclosing func, @var, @match or @catch
+	freeVarAnalyser struct {
+		scopes []map[string]bool
+		free   map[string]bool
+	}
+)
+
+const PRINT_WIDTH = 80
+
+// PrettyPrint renders the node as formatted toy-script source
+func PrettyPrint(n Node) string {
+	return n.Accept(&astPrinter{}).(string)
+}
+
+// CountNodes returns the number of nodes of every type in the tree
+func CountNodes(n Node) map[string]int {
+	c := &nodeCounter{map[string]int{}}
+	n.Accept(c)
+	return c.counts
+}
+
+// FreeVariables returns the sorted names the node references but doesn't bind
+func FreeVariables(n Node) []string {
+	a := &freeVarAnalyser{free: map[string]bool{}}
+	n.Accept(a)
+	return slices.Sorted(maps.Keys(a.free))
+}
+
+// BlockBindings returns the names bound by @var in a block,
+// skipping nested funcs, @match cases, @catch handlers and @async branches which are blocks of their own
+func BlockBindings(nodes ...Node) []string {
+	names := []string{}
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *VarStatement:
+			for _, b := range n.Vars {
+				names = append(names, BlockBindings(b.Value)...)
+				names = append(names, b.Name)
+			}
+		case *ListLiteral:
+			names = append(names, BlockBindings(n.Elements...)...)
+		case *HashLiteral:
+			for _, el := range n.Elements {
+				names = append(names, BlockBindings(el.Value)...)
+			}
+		case *CallExpression:
+			names = append(names, BlockBindings(n.Callee)...)
+			names = append(names, BlockBindings(n.Args...)...)
+		case *SeqExpression:
+			names = append(names, BlockBindings(n.Expressions...)...)
+		case *LogicalExpression:
+			names = append(names, BlockBindings(n.Operands...)...)
+		case *MatchExpression:
+			names = append(names, BlockBindings(n.Cond)...)
+		case *TryExpression:
+			names = append(names, BlockBindings(n.Body)...)
+		}
+	}
+
+	return names
+}
+
+// PRETTY PRINTER
+
+func (p *astPrinter) print(n Node) string {
+	p.indent += 1
+	defer func() { p.indent -= 1 }()
+
+	return n.Accept(p).(string)
+}
+
+func (p *astPrinter) prints(ns []Node) []string {
+	parts := []string{}
+	for _, n := range ns {
+		parts = append(parts, p.print(n))
+	}
+	return parts
+}
+
+// form lays out the parts on a single line when they fit, otherwise
+// the first keep parts stay on the opening line and the rest get a line each
+func (p *astPrinter) form(keep int, parts ...string) string {
+	flat := "(" + strings.Join(parts, " ") + ")"
+	if len(parts) <= keep || !strings.Contains(flat, "\n") && p.indent*2+len(flat) <= PRINT_WIDTH {
+		return flat
+	}
+
+	pad := "\n" + strings.Repeat("  ", p.indent+1)
+	return "(" + strings.Join(parts[:keep], " ") + pad + strings.Join(parts[keep:], pad) + ")"
+}
+
+func (p *astPrinter) VisitString(n *StringLiteral) any {
+	return `"` + n.Value + `"`
+}
+
+func (p *astPrinter) VisitNumber(n *NumberLiteral) any {
+	str := FormatNumber(n.Value)
+	if _, isFloat := n.Value.(float64); isFloat && !strings.ContainsAny(str, ".eIN") {
+		// NOTE: keep whole floats as floats when parsed back
+		str += ".0"
+	}
+	return str
+}
+
+func (p *astPrinter) VisitBoolean(n *BooleanLiteral) any {
+	return fmt.Sprint(n.Value)
+}
+
+func (p *astPrinter) VisitList(n *ListLiteral) any {
+	return p.form(1, append([]string{"@list"}, p.prints(n.Elements)...)...)
+}
+
+func (p *astPrinter) VisitHash(n *HashLiteral) any {
+	parts := []string{"@hash"}
+	for _, el := range n.Elements {
+		p.indent += 1
+		parts = append(parts, p.form(1, `"`+el.Key+`"`, p.print(el.Value)))
+		p.indent -= 1
+	}
+	return p.form(1, parts...)
+}
+
+func (p *astPrinter) VisitStream(n *StreamLiteral) any {
+	parts := []string{"@stream"}
+	if n.Capacity != nil {
+		p.indent += 1
+		parts = append(parts, p.form(2, "@capacity", p.print(n.Capacity)))
+		p.indent -= 1
+	}
+	return p.form(1, append(parts, p.prints(n.Values)...)...)
+}
+
+func (p *astPrinter) VisitFunc(n *FuncLiteral) any {
+	p.indent += 1
+	body := p.form(1, p.prints(n.Body)...)
+	p.indent -= 1
+
+	return p.form(2, "@func", "("+strings.Join(n.Params, " ")+")", body)
+}
+
+func (p *astPrinter) VisitProgram(n *ProgramStatement) any {
+	statements := []string{}
+	for _, s := range n.Body {
+		statements = append(statements, s.Accept(p).(string))
+	}
+	return strings.Join(statements, "\n")
+}
+
+func (p *astPrinter) VisitVar(n *VarStatement) any {
+	parts := []string{"@var"}
+	for _, b := range n.Vars {
+		p.indent += 1
+		parts = append(parts, p.form(1, b.Name, p.print(b.Value)))
+		p.indent -= 1
+	}
+	return p.form(1, parts...)
+}
+
+func (p *astPrinter) VisitImport(n *ImportStatement) any {
+	parts := []string{"@import"}
+	for _, alias := range slices.Sorted(maps.Keys(n.Imports)) {
+		parts = append(parts, "("+alias+` "`+n.Imports[alias]+`")`)
+	}
+	return p.form(1, parts...)
+}
+
+func (p *astPrinter) VisitExport(n *ExportStatement) any {
+	return p.form(1, append([]string{"@export"}, p.prints(n.Exports)...)...)
+}
+
+func (p *astPrinter) VisitRef(n *ReferenceExpression) any {
+	return n.RefName
+}
+
+func (p *astPrinter) VisitCall(n *CallExpression) any {
+	return p.form(1, append([]string{p.print(n.Callee)}, p.prints(n.Args)...)...)
+}
+
+func (p *astPrinter) VisitMatch(n *MatchExpression) any {
+	parts := []string{"@match", p.print(n.Cond)}
+	for _, c := range n.Cases {
+		p.indent += 1
+		parts = append(parts, p.form(2, "@when", p.print(c.When), p.print(c.Then)))
+		p.indent -= 1
+	}
+	return p.form(2, parts...)
+}
+
+func (p *astPrinter) VisitMalformed(n *MalformedExpression) any {
+	return fmt.Sprintf("(@malformed %q)", fmt.Sprint(n.Error))
+}
+
+func (p *astPrinter) VisitSeq(n *SeqExpression) any {
+	return p.form(1, append([]string{"@seq"}, p.prints(n.Expressions)...)...)
+}
+
+func (p *astPrinter) VisitChain(n *ChainExpression) any {
+	return p.form(1, append([]string{"@chain"}, p.prints(n.Expressions)...)...)
+}
+
+func (p *astPrinter) VisitAsync(n *AsyncExpression) any {
+	parts := []string{"@async"}
+	if n.Ordered {
+		parts = append(parts, "(@ordered)")
+	}
+	return p.form(len(parts), append(parts, p.prints(n.Expressions)...)...)
+}
+
+func (p *astPrinter) VisitLogical(n *LogicalExpression) any {
+	return p.form(1, append([]string{n.Operator}, p.prints(n.Operands)...)...)
+}
+
+func (p *astPrinter) VisitTry(n *TryExpression) any {
+	p.indent += 1
+	catch := p.form(2, "@catch", n.ErrName, p.print(n.Handler))
+	p.indent -= 1
+	return p.form(1, "@try", p.print(n.Body), catch)
+}
+
+func (p *astPrinter) VisitSelect(n *SelectExpression) any {
+	parts := []string{"@select"}
+	p.indent += 1
+	for _, c := range n.Cases {
+		parts = append(parts, p.form(2, "@when", p.print(c.Stream), p.print(c.Then)))
+	}
+	if n.Default != nil {
+		parts = append(parts, p.form(1, "@default", p.print(n.Default)))
+	}
+	if n.Timeout != nil {
+		parts = append(parts, p.form(2, "@timeout", p.print(n.Timeout.After), p.print(n.Timeout.Then)))
+	}
+	p.indent -= 1
+	return p.form(1, parts...)
+}
+
+// NODE COUNTER
+
+func (c *nodeCounter) count(n Node, children ...Node) any {
+	c.counts[n.Type()] += 1
+	for _, child := range children {
+		child.Accept(c)
+	}
+	return nil
+}
+
+func (c *nodeCounter) VisitString(n *StringLiteral) any {
+	return c.count(n)
+}
+
+func (c *nodeCounter) VisitNumber(n *NumberLiteral) any {
+	return c.count(n)
+}
+
+func (c *nodeCounter) VisitBoolean(n *BooleanLiteral) any {
+	return c.count(n)
+}
+
+func (c *nodeCounter) VisitList(n *ListLiteral) any {
+	return c.count(n, n.Elements...)
+}
+
+func (c *nodeCounter) VisitHash(n *HashLiteral) any {
+	values := []Node{}
+	for _, el := range n.Elements {
+		values = append(values, el.Value)
+	}
+	return c.count(n, values...)
+}
+
+func (c *nodeCounter) VisitStream(n *StreamLiteral) any {
+	return c.count(n, streamParts(n)...)
+}
+
+func (c *nodeCounter) VisitFunc(n *FuncLiteral) any {
+	return c.count(n, n.Body...)
+}
+
+func (c *nodeCounter) VisitProgram(n *ProgramStatement) any {
+	return c.count(n, n.Body...)
+}
+
+func (c *nodeCounter) VisitVar(n *VarStatement) any {
+	values := []Node{}
+	for _, b := range n.Vars {
+		values = append(values, b.Value)
+	}
+	return c.count(n, values...)
+}
+
+func (c *nodeCounter) VisitImport(n *ImportStatement) any {
+	return c.count(n)
+}
+
+func (c *nodeCounter) VisitExport(n *ExportStatement) any {
+	return c.count(n, n.Exports...)
+}
+
+func (c *nodeCounter) VisitRef(n *ReferenceExpression) any {
+	return c.count(n)
+}
+
+func (c *nodeCounter) VisitCall(n *CallExpression) any {
+	return c.count(n, append([]Node{n.Callee}, n.Args...)...)
+}
+
+func (c *nodeCounter) VisitMatch(n *MatchExpression) any {
+	children := []Node{n.Cond}
+	for _, mc := range n.Cases {
+		children = append(children, mc.When, mc.Then)
+	}
+	return c.count(n, children...)
+}
+
+func (c *nodeCounter) VisitMalformed(n *MalformedExpression) any {
+	return c.count(n)
+}
+
+func (c *nodeCounter) VisitSeq(n *SeqExpression) any {
+	return c.count(n, n.Expressions...)
+}
+
+func (c *nodeCounter) VisitChain(n *ChainExpression) any {
+	return c.count(n, n.Expressions...)
+}
+
+func (c *nodeCounter) VisitAsync(n *AsyncExpression) any {
+	return c.count(n, n.Expressions...)
+}
+
+func (c *nodeCounter) VisitLogical(n *LogicalExpression) any {
+	return c.count(n, n.Operands...)
+}
+
+func (c *nodeCounter) VisitTry(n *TryExpression) any {
+	return c.count(n, n.Body, n.Handler)
+}
+
+func (c *nodeCounter) VisitSelect(n *SelectExpression) any {
+	children := []Node{}
+	for _, sc := range n.Cases {
+		children = append(children, sc.Stream, sc.Then)
+	}
+	if n.Default != nil {
+		children = append(children, n.Default)
+	}
+	if n.Timeout != nil {
+		children = append(children, n.Timeout.After, n.Timeout.Then)
+	}
+	return c.count(n, children...)
+}
+
+// FREE VARIABLE ANALYSER
+
+// block visits the nodes in a new scope, binding names and the @var bindings
+// of the block up front since funcs see the bindings made after their definition
+func (a *freeVarAnalyser) block(names []string, nodes ...Node) any {
+	scope := map[string]bool{}
+	for _, name := range append(names, BlockBindings(nodes...)...) {
+		scope[name] = true
+	}
+
+	a.scopes = append(a.scopes, scope)
+	a.visit(nodes...)
+	a.scopes = a.scopes[:len(a.scopes)-1]
+	return nil
+}
+
+func (a *freeVarAnalyser) visit(nodes ...Node) any {
+	for _, n := range nodes {
+		n.Accept(a)
+	}
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitString(n *StringLiteral) any {
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitNumber(n *NumberLiteral) any {
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitBoolean(n *BooleanLiteral) any {
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitList(n *ListLiteral) any {
+	return a.visit(n.Elements...)
+}
+
+func (a *freeVarAnalyser) VisitHash(n *HashLiteral) any {
+	for _, el := range n.Elements {
+		a.visit(el.Value)
+	}
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitStream(n *StreamLiteral) any {
+	return a.visit(streamParts(n)...)
+}
+
+func (a *freeVarAnalyser) VisitFunc(n *FuncLiteral) any {
+	return a.block(n.Params, n.Body...)
+}
+
+func (a *freeVarAnalyser) VisitProgram(n *ProgramStatement) any {
+	return a.block(nil, n.Body...)
+}
+
+func (a *freeVarAnalyser) VisitVar(n *VarStatement) any {
+	for _, b := range n.Vars {
+		a.visit(b.Value)
+	}
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitImport(n *ImportStatement) any {
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitExport(n *ExportStatement) any {
+	return a.visit(n.Exports...)
+}
+
+func (a *freeVarAnalyser) VisitRef(n *ReferenceExpression) any {
+	if n.RefType != REF_TYPE_DECLARED {
+		return nil
+	}
+
+	for _, scope := range a.scopes {
+		if scope[n.RefName] {
+			return nil
+		}
+	}
+
+	a.free[n.RefName] = true
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitCall(n *CallExpression) any {
+	a.visit(n.Callee)
+	return a.visit(n.Args...)
+}
+
+func (a *freeVarAnalyser) VisitMatch(n *MatchExpression) any {
+	a.visit(n.Cond)
+
+	cases := []Node{}
+	for _, c := range n.Cases {
+		cases = append(cases, c.When, c.Then)
+	}
+	return a.block([]string{"value"}, cases...)
+}
+
+func (a *freeVarAnalyser) VisitMalformed(n *MalformedExpression) any {
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitSeq(n *SeqExpression) any {
+	return a.visit(n.Expressions...)
+}
+
+func (a *freeVarAnalyser) VisitChain(n *ChainExpression) any {
+	return a.visit(n.Expressions...)
+}
+
+func (a *freeVarAnalyser) VisitAsync(n *AsyncExpression) any {
+	// NOTE: every branch binds its own names
+	for _, e := range n.Expressions {
+		a.block(nil, e)
+	}
+	return nil
+}
+
+func (a *freeVarAnalyser) VisitLogical(n *LogicalExpression) any {
+	return a.visit(n.Operands...)
+}
+
+func (a *freeVarAnalyser) VisitTry(n *TryExpression) any {
+	a.visit(n.Body)
+	return a.block([]string{n.ErrName}, n.Handler)
+}
+
+func (a *freeVarAnalyser) VisitSelect(n *SelectExpression) any {
+	for _, c := range n.Cases {
+		a.visit(c.Stream)
+		a.block([]string{"value"}, c.Then)
+	}
+	if n.Default != nil {
+		a.block(nil, n.Default)
+	}
+	if n.Timeout != nil {
+		a.visit(n.Timeout.After)
+		a.block(nil, n.Timeout.Then)
+	}
+	return nil
+}
+
+// streamParts are the capacity, when given, and the values of a stream literal
+func streamParts(n *StreamLiteral) []Node {
+	if n.Capacity == nil {
+		return n.Values
+	}
+
+	return append([]Node{n.Capacity}, n.Values...)
+}
+
+// CalleeName is the name of a called ref, or the type of any other callee
+func CalleeName(n Node) string {
+	if ref, ok := n.(*ReferenceExpression); ok {
+		return ref.RefName
+	}
+
+	return n.Type()
+}
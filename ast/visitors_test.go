@@ -0,0 +1,112 @@
+package ast_test
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"toyscript/ast"
+	"toyscript/parser"
+)
+
+// NOTE: an external test package, the parser depends on ast
+
+func parse(t *testing.T, source string) *ast.ProgramStatement {
+	t.Helper()
+
+	program, err := parser.ParseSource("<test>", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return program
+}
+
+func TestPrettyPrint(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"statements", `(@var (x 1.0)   (s "a"))
+			(+ x 2)`, "(@var (x 1.0) (s \"a\"))\n(+ x 2)"},
+		{"sorted imports", `(@import (stdio "std/stdio") (io "./io.toy"))`, `(@import (io "./io.toy") (stdio "std/stdio"))`},
+		{"nested forms", `(@match y (@when 1 value) (@when 2 (@try (f) (@catch e (g e)))))`,
+			`(@match y (@when 1 value) (@when 2 (@try (f) (@catch e (g e)))))`},
+		{"async and select", `(@async (@ordered) 1 2) (@select (@when s value) (@timeout 10 w))`,
+			"(@async (@ordered) 1 2)\n(@select (@when s value) (@timeout 10 w))"},
+		{"long forms", `(@var (long (@func (first second) ((@var (x 1)) (@list first second "a long string literal" "another long string literal")))))`,
+			strings.Join([]string{
+				`(@var`,
+				`  (long`,
+				`    (@func (first second)`,
+				`      ((@var (x 1))`,
+				`        (@list`,
+				`          first`,
+				`          second`,
+				`          "a long string literal"`,
+				`          "another long string literal")))))`,
+			}, "\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ast.PrettyPrint(parse(t, tt.source))
+			if got != tt.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tt.want)
+			}
+
+			// NOTE: printing the printed source again changes nothing
+			if again := ast.PrettyPrint(parse(t, got)); again != got {
+				t.Errorf("not stable, printed again\n%s", again)
+			}
+		})
+	}
+}
+
+func TestCountNodes(t *testing.T) {
+	program := parse(t, `
+		(@var (add (@func (a b) ((+ a b)))))
+		(@match (add 1 2) (@when 3 (@list "three" value)))`)
+
+	want := map[string]int{
+		"ProgramStatement":    1,
+		"VarStatement":        1,
+		"FuncLiteral":         1,
+		"CallExpression":      2,
+		"ReferenceExpression": 5,
+		"NumberLiteral":       3,
+		"MatchExpression":     1,
+		"ListLiteral":         1,
+		"StringLiteral":       1,
+	}
+	if got := ast.CountNodes(program); !maps.Equal(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestFreeVariables(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"bound by @var", `(@var (x 1)) (+ x y)`, "y"},
+		{"params and closures", `(@var (adder (@func (a) ((@func (b) ((+ a b c)))))))`, "c"},
+		{"bound after the func", `(@var (f (@func () (g))) (g (@func () (1))))`, ""},
+		{"match value", `(@match x (@when 1 value))`, "x"},
+		{"caught error", `(@try (f) (@catch e (g e)))`, "f g"},
+		{"imports and built-ins", `(@import (stdio "std/stdio")) (stdio.print (@len s))`, "s"},
+		{"select", `(@select (@when s (+ value n)) (@timeout t w))`, "n s t w"},
+		{"async branches", `(@async (@seq (@var (a 1)) a) b) (f a)`, "a b f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(ast.FreeVariables(parse(t, tt.source)), " ")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"toyscript/ast"
+	"toyscript/interpreter"
+)
+
+// benchScript runs the script on every engine and compares the average run time,
+// the output of the script is discarded
+func benchScript(filename string, runs int) error {
+	script, err := interpreter.LoadScript(filename)
+	if err != nil {
+		return err
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+
+	nodes := 0
+	for _, count := range ast.CountNodes(script.Program) {
+		nodes += count
+	}
+	fmt.Printf("%s (%d nodes, %d runs)\n", filename, nodes, runs)
+
+	var baseline time.Duration
+	for _, name := range []string{interpreter.ENGINE_TREE, interpreter.ENGINE_VM} {
+		stdout := os.Stdout
+		os.Stdout = devNull
+
+		var elapsed time.Duration
+		for range runs {
+			evaler, _ := interpreter.NewEngine(name)
+			script.Preload(evaler)
+
+			start := time.Now()
+			err = evaler.Exec(filename, script.Program)
+			elapsed += time.Since(start)
+			if err != nil {
+				break
+			}
+		}
+
+		os.Stdout = stdout
+		if err != nil {
+			return fmt.Errorf("%s engine: %w", name, err)
+		}
+
+		perRun := elapsed / time.Duration(runs)
+		if baseline == 0 {
+			baseline = perRun
+			fmt.Printf("  %-5s %12s/run\n", name, perRun)
+			continue
+		}
+		fmt.Printf("  %-5s %12s/run  %.2fx\n", name, perRun, float64(baseline)/float64(perRun))
+	}
+
+	return nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"toyscript/ast"
+	"toyscript/interpreter"
+	"toyscript/lexer"
+	"toyscript/parser"
+)
+
+// NOTE: the checker mirrors the scoping of the interpreter. Funcs, @match cases,
+// @catch handlers and @async branches are blocks, and the @var bindings of a block
+// are visible to the whole block, as funcs see the bindings made after their definition.
+
+type (
+	// toyChecker finds problems in a script without executing it
+	toyChecker struct {
+		scopes      []*checkScope
+		modules     map[string]*checkModule
+		loader      *interpreter.ModuleLoader
+		builtins    map[string]bool
+		diagnostics []parser.Diagnostic
+	}
+
+	checkScope struct {
+		bindings map[string]*checkBinding
+		// bound are the names already bound by a @var of the block
+		bound map[string]bool
+	}
+
+	// checkBinding is a name in scope, fn is set when it's bound to a func literal
+	checkBinding struct {
+		fn *ast.FuncLiteral
+	}
+
+	// checkModule lists the exports of an imported module,
+	// with the func literal of the exported funcs
+	checkModule struct {
+		path    string
+		exports map[string]*ast.FuncLiteral
+		loaded  bool
+	}
+)
+
+// checkProgram reports undefined refs, unknown import members, undeclared exports,
+// duplicate bindings and calls with the wrong number of args to known funcs.
+// Imports are resolved relative to filename.
+func checkProgram(filename string, p *ast.ProgramStatement) []parser.Diagnostic {
+	c := &toyChecker{
+		modules:  map[string]*checkModule{},
+		loader:   interpreter.NewModuleLoader(),
+		builtins: map[string]bool{},
+	}
+	for _, name := range interpreter.Builtins() {
+		c.builtins[name] = true
+	}
+
+	c.loader.Enter(filename, func() error {
+		p.Accept(c)
+		return nil
+	})
+
+	slices.SortStableFunc(c.diagnostics, func(a, b parser.Diagnostic) int {
+		return a.Span.Start.Offset - b.Span.Start.Offset
+	})
+	return c.diagnostics
+}
+
+// checkScripts prints the problems found in every script and reports whether there were none
+func checkScripts(paths []string) bool {
+	ok := true
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+			continue
+		}
+
+		program, err := parser.ParseSource(path, string(source))
+		if err != nil {
+			fmt.Println(err)
+			ok = false
+			continue
+		}
+
+		diagnostics := checkProgram(path, program)
+		if len(diagnostics) > 0 {
+			fmt.Println(parser.FormatReport(path, string(source), diagnostics, "problem"))
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func (c *toyChecker) report(span lexer.Span, format string, a ...any) {
+	c.diagnostics = append(c.diagnostics, parser.Diagnostic{Message: fmt.Sprintf(format, a...), Span: span})
+}
+
+// block visits the nodes in a new scope with names and the @var bindings of the block
+func (c *toyChecker) block(names []string, nodes ...ast.Node) {
+	scope := &checkScope{map[string]*checkBinding{}, map[string]bool{}}
+	for _, name := range append(names, ast.BlockBindings(nodes...)...) {
+		scope.bindings[name] = &checkBinding{}
+	}
+
+	c.scopes = append(c.scopes, scope)
+	c.visit(nodes...)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *toyChecker) visit(nodes ...ast.Node) any {
+	for _, n := range nodes {
+		n.Accept(c)
+	}
+	return nil
+}
+
+func (c *toyChecker) lookup(name string) (*checkBinding, bool) {
+	for idx := len(c.scopes) - 1; idx >= 0; idx -= 1 {
+		if b, ok := c.scopes[idx].bindings[name]; ok {
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+// imported resolves a module.member ref, problems are reported at span
+func (c *toyChecker) imported(name string, span lexer.Span) (*ast.FuncLiteral, bool) {
+	alias, member, found := strings.Cut(name, ".")
+	if !found {
+		c.report(span, "malformed imported ref %s", name)
+		return nil, false
+	}
+
+	module, ok := c.modules[alias]
+	if !ok {
+		c.report(span, "unknown module %s", alias)
+		return nil, false
+	}
+	if !module.loaded {
+		// NOTE: already reported at the import
+		return nil, false
+	}
+
+	fn, ok := module.exports[member]
+	if !ok {
+		c.report(span, "module %s has no member %s", alias, member)
+		return nil, false
+	}
+
+	return fn, true
+}
+
+// loadImport reads the exports of a module without executing it
+func (c *toyChecker) loadImport(alias string, path string, span lexer.Span) {
+	module := &checkModule{path: path, exports: map[string]*ast.FuncLiteral{}}
+	c.modules[alias] = module
+
+	if members, isNative := interpreter.NativeMembers(path); isNative {
+		for _, member := range members {
+			module.exports[member] = nil
+		}
+		module.loaded = true
+		return
+	}
+
+	canonical, err := c.loader.Resolve(path)
+	if err != nil {
+		c.report(span, "%s", err.Error())
+		return
+	}
+	if err := c.loader.FindCycle(canonical); err != nil {
+		c.report(span, "%s", err.Error())
+	}
+
+	program, err := c.loader.Parse(canonical)
+	if err != nil {
+		c.report(span, "module %s has syntax errors", path)
+		return
+	}
+
+	funcs := map[string]*ast.FuncLiteral{}
+	var exports *ast.ExportStatement
+	for _, s := range program.Body {
+		switch s := s.(type) {
+		case *ast.VarStatement:
+			for _, b := range s.Vars {
+				fn, _ := b.Value.(*ast.FuncLiteral)
+				funcs[b.Name] = fn
+			}
+		case *ast.ExportStatement:
+			// NOTE: the last export statement wins, as in the interpreter
+			exports = s
+		}
+	}
+
+	if exports == nil {
+		c.report(span, "module %s has no exports", path)
+		return
+	}
+
+	for _, e := range exports.Exports {
+		name := e.(*ast.ReferenceExpression).RefName
+		module.exports[name] = funcs[name]
+	}
+	module.loaded = true
+}
+
+func (c *toyChecker) VisitString(n *ast.StringLiteral) any {
+	return nil
+}
+
+func (c *toyChecker) VisitNumber(n *ast.NumberLiteral) any {
+	return nil
+}
+
+func (c *toyChecker) VisitBoolean(n *ast.BooleanLiteral) any {
+	return nil
+}
+
+func (c *toyChecker) VisitList(n *ast.ListLiteral) any {
+	return c.visit(n.Elements...)
+}
+
+func (c *toyChecker) VisitHash(n *ast.HashLiteral) any {
+	for _, el := range n.Elements {
+		c.visit(el.Value)
+	}
+	return nil
+}
+
+func (c *toyChecker) VisitStream(n *ast.StreamLiteral) any {
+	if n.Capacity != nil {
+		c.visit(n.Capacity)
+	}
+	return c.visit(n.Values...)
+}
+
+func (c *toyChecker) VisitFunc(n *ast.FuncLiteral) any {
+	seen := map[string]bool{}
+	for idx, p := range n.Params {
+		if seen[p] {
+			c.report(n.ParamSpans[idx], "duplicate param %s", p)
+		}
+		seen[p] = true
+	}
+
+	c.block(n.Params, n.Body...)
+	return nil
+}
+
+func (c *toyChecker) VisitProgram(n *ast.ProgramStatement) any {
+	// NOTE: imports are always global, so they're loaded up front
+	aliases := []string{}
+	for _, s := range n.Body {
+		imprt, ok := s.(*ast.ImportStatement)
+		if !ok {
+			continue
+		}
+
+		for _, alias := range slices.Sorted(maps.Keys(imprt.Imports)) {
+			c.loadImport(alias, imprt.Imports[alias], imprt.Span)
+			aliases = append(aliases, alias)
+		}
+	}
+
+	c.block(aliases, n.Body...)
+	return nil
+}
+
+func (c *toyChecker) VisitVar(n *ast.VarStatement) any {
+	scope := c.scopes[len(c.scopes)-1]
+	for _, b := range n.Vars {
+		if scope.bound[b.Name] {
+			c.report(b.NameSpan, "duplicate binding %s", b.Name)
+		}
+		scope.bound[b.Name] = true
+
+		// NOTE: bound before the value is visited, so recursive calls are checked too
+		fn, _ := b.Value.(*ast.FuncLiteral)
+		scope.bindings[b.Name] = &checkBinding{fn}
+		c.visit(b.Value)
+	}
+	return nil
+}
+
+func (c *toyChecker) VisitImport(n *ast.ImportStatement) any {
+	return nil
+}
+
+func (c *toyChecker) VisitExport(n *ast.ExportStatement) any {
+	program := c.scopes[0]
+	for _, e := range n.Exports {
+		ref := e.(*ast.ReferenceExpression)
+		if _, ok := program.bindings[ref.RefName]; !ok {
+			c.report(ref.Span, "export of undeclared name %s", ref.RefName)
+		}
+	}
+	return nil
+}
+
+func (c *toyChecker) VisitRef(n *ast.ReferenceExpression) any {
+	switch n.RefType {
+	case ast.REF_TYPE_IMPORTED:
+		c.imported(n.RefName, n.Span)
+	case ast.REF_TYPE_BUILTIN:
+		if !c.builtins[n.RefName] {
+			c.report(n.Span, "unknown built-in %s", n.RefName)
+		}
+	default:
+		if _, ok := c.lookup(n.RefName); ok {
+			return nil
+		}
+		if c.builtins[n.RefName] {
+			return nil
+		}
+		c.report(n.Span, "undefined identifier %s", n.RefName)
+	}
+	return nil
+}
+
+func (c *toyChecker) VisitCall(n *ast.CallExpression) any {
+	var fn *ast.FuncLiteral
+	switch callee := n.Callee.(type) {
+	case *ast.ReferenceExpression:
+		switch callee.RefType {
+		case ast.REF_TYPE_IMPORTED:
+			fn, _ = c.imported(callee.RefName, callee.Span)
+		case ast.REF_TYPE_DECLARED:
+			if b, ok := c.lookup(callee.RefName); ok {
+				fn = b.fn
+			}
+			c.VisitRef(callee)
+		default:
+			c.VisitRef(callee)
+		}
+	default:
+		c.visit(n.Callee)
+	}
+
+	if fn != nil && len(n.Args) != len(fn.Params) {
+		plural := "s"
+		if len(fn.Params) == 1 {
+			plural = ""
+		}
+		c.report(n.Span, "%s expects %d argument%s, got %d", ast.CalleeName(n.Callee), len(fn.Params), plural, len(n.Args))
+	}
+
+	return c.visit(n.Args...)
+}
+
+func (c *toyChecker) VisitMatch(n *ast.MatchExpression) any {
+	c.visit(n.Cond)
+
+	cases := []ast.Node{}
+	for _, mc := range n.Cases {
+		cases = append(cases, mc.When, mc.Then)
+	}
+	c.block([]string{"value"}, cases...)
+	return nil
+}
+
+func (c *toyChecker) VisitMalformed(n *ast.MalformedExpression) any {
+	return nil
+}
+
+func (c *toyChecker) VisitSeq(n *ast.SeqExpression) any {
+	return c.visit(n.Expressions...)
+}
+
+func (c *toyChecker) VisitChain(n *ast.ChainExpression) any {
+	return c.visit(n.Expressions...)
+}
+
+func (c *toyChecker) VisitAsync(n *ast.AsyncExpression) any {
+	for _, e := range n.Expressions {
+		c.block(nil, e)
+	}
+	return nil
+}
+
+func (c *toyChecker) VisitLogical(n *ast.LogicalExpression) any {
+	return c.visit(n.Operands...)
+}
+
+func (c *toyChecker) VisitTry(n *ast.TryExpression) any {
+	c.visit(n.Body)
+	c.block([]string{n.ErrName}, n.Handler)
+	return nil
+}
+
+func (c *toyChecker) VisitSelect(n *ast.SelectExpression) any {
+	for _, sc := range n.Cases {
+		c.visit(sc.Stream)
+		c.block([]string{"value"}, sc.Then)
+	}
+	if n.Default != nil {
+		c.block(nil, n.Default)
+	}
+	if n.Timeout != nil {
+		c.visit(n.Timeout.After)
+		c.block(nil, n.Timeout.Then)
+	}
+	return nil
+}
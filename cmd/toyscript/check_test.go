@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"toyscript/parser"
+)
+
+// NOTE: the problems found in every testdata/check/name.toy are reported in name.golden,
+// the modules they import are in testdata/check/modules
+func TestCheckGolden(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/check/*.toy")
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no scripts to check: %v", err)
+	}
+
+	for _, script := range scripts {
+		t.Run(strings.TrimSuffix(filepath.Base(script), ".toy"), func(t *testing.T) {
+			source, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			program, err := parser.ParseSource(script, string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diagnostics := checkProgram(script, program)
+			got := parser.FormatReport(script, string(source), diagnostics, "problem") + "\n"
+			compareGolden(t, strings.TrimSuffix(script, ".toy")+".golden", got)
+		})
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	dir := t.TempDir()
+	clean := filepath.Join(dir, "clean.toy")
+	if err := os.WriteFile(clean, []byte("(@var (x 1))\n(+ x 1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, code := runCommand(t, "check", clean); code != 0 {
+		t.Errorf("clean script: got exit code %d with\n%s", code, out)
+	}
+	if _, code := runCommand(t, "check", clean, "testdata/check/arity.toy"); code != 1 {
+		t.Errorf("got exit code %d, want 1", code)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"toyscript/ast"
+	"toyscript/lexer"
+	"toyscript/parser"
+)
+
+// dumpTokens writes the tokens of the script, including comments, as JSON
+func dumpTokens(w io.Writer, source string) error {
+	tokens, err := lexer.NewScanner(source).ScanTokens()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, tokens)
+}
+
+// dumpAST writes the AST of the script as JSON, malformed forms included.
+// Syntax errors are returned after the AST is written.
+func dumpAST(w io.Writer, filename string, source string) error {
+	tokens, err := lexer.NewScanner(source).ScanTokens()
+	if err != nil {
+		return err
+	}
+
+	program, diagnostics := parser.NewParser(tokens).Parse()
+	if err := writeJSON(w, ast.ASTJSON(&program)); err != nil {
+		return err
+	}
+
+	if len(diagnostics) > 0 {
+		return errors.New(parser.FormatDiagnostics(filename, source, diagnostics))
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// NOTE: every testdata/dump/name.toy is dumped into name.tokens.json and name.ast.json
+func TestDumpGolden(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/dump/*.toy")
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no scripts to dump: %v", err)
+	}
+
+	for _, script := range scripts {
+		source, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		base := strings.TrimSuffix(script, ".toy")
+		t.Run(filepath.Base(base)+"/tokens", func(t *testing.T) {
+			out := strings.Builder{}
+			if err := dumpTokens(&out, string(source)); err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, base+".tokens.json", out.String())
+		})
+
+		t.Run(filepath.Base(base)+"/ast", func(t *testing.T) {
+			out := strings.Builder{}
+			// NOTE: the AST of a malformed script is still written
+			err := dumpAST(&out, script, string(source))
+			if malformed := strings.HasPrefix(filepath.Base(base), "malformed"); malformed != (err != nil) {
+				t.Fatalf("got error %v", err)
+			}
+			compareGolden(t, base+".ast.json", out.String())
+		})
+	}
+}
+
+func TestDumpCommands(t *testing.T) {
+	for _, cmd := range []string{"tokens", "ast"} {
+		want, err := os.ReadFile("testdata/dump/script." + cmd + ".json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, code := runCommand(t, cmd, "testdata/dump/script.toy")
+		if code != 0 || out != string(want) {
+			t.Errorf("%s: got exit code %d with\n%s", cmd, code, out)
+		}
+	}
+
+	// NOTE: the AST of a malformed script is written before the syntax errors are reported
+	out, code := runCommand(t, "ast", "testdata/dump/malformed.toy")
+	if want, _ := os.ReadFile("testdata/dump/malformed.ast.json"); code != 1 || out != string(want) {
+		t.Errorf("malformed: got exit code %d with\n%s", code, out)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"toyscript/lexer"
+	"toyscript/parser"
+)
+
+// NOTE: the formatter lays out a tree of the tokens rather than the AST,
+// so comments and blank lines between forms survive formatting.
+// A form is kept on one line when it fits, otherwise:
+//
+//	(@var            @var, @import, @export, @match, @chain and long calls
+//	  (a 1)          put every part on its own line and close on a line of their own
+//	)
+//
+//	(f (@func (x) (  a func body, a @var binding, a hash entry or the last argument
+//	  (g x)          of a call hang from the line they start on
+//	)))
+
+type (
+	// fmtNode is an atom, a comment or a parenthesised list of the token tree
+	fmtNode struct {
+		text        string
+		comment     bool
+		list        bool
+		children    []*fmtNode
+		trailing    string
+		blankBefore bool
+		line        int
+		endLine     int
+	}
+)
+
+const FORMAT_WIDTH = 80
+
+// formatSource returns the canonical layout of a script, scripts with syntax errors are rejected
+func formatSource(filename string, source string) (string, error) {
+	if _, err := parser.ParseSource(filename, source); err != nil {
+		return "", err
+	}
+
+	tokens, err := lexer.NewScanner(source).ScanTokens()
+	if err != nil {
+		return "", err
+	}
+
+	// NOTE: drop the EOF token
+	nodes, _ := fmtTree(tokens[:len(tokens)-1], 0)
+
+	str := strings.Builder{}
+	for idx, n := range nodes {
+		if idx > 0 {
+			str.WriteString("\n")
+			if n.blankBefore {
+				str.WriteString("\n")
+			}
+		}
+		str.WriteString(fmtRender(n, 0, 0, "@program"))
+		str.WriteString(n.trailing)
+	}
+	str.WriteString("\n")
+
+	return str.String(), nil
+}
+
+// formatScripts rewrites the scripts in their canonical layout, in check mode
+// the unformatted scripts are only listed. It reports whether all were formatted,
+// scripts which fail to parse are reported and skipped.
+func formatScripts(paths []string, check bool) bool {
+	formatted := true
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			formatted = false
+			continue
+		}
+
+		out, err := formatSource(path, string(source))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			formatted = false
+			continue
+		}
+		if out == string(source) {
+			continue
+		}
+
+		if check {
+			fmt.Println(path)
+			formatted = false
+			continue
+		}
+
+		if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			formatted = false
+		}
+	}
+
+	return formatted
+}
+
+// fmtTree groups the tokens into lists, up to the closing paren of the current list
+func fmtTree(tokens []lexer.Token, idx int) ([]*fmtNode, int) {
+	nodes := []*fmtNode{}
+	var last *fmtNode
+
+	for idx < len(tokens) {
+		t := tokens[idx]
+
+		var n *fmtNode
+		switch t.Type {
+		case lexer.TOKEN_RIGHT_PAREN:
+			return nodes, idx
+		case lexer.TOKEN_LEFT_PAREN:
+			children, end := fmtTree(tokens, idx+1)
+			n = &fmtNode{list: true, children: children, line: t.Span.Start.Line, endLine: t.Span.Start.Line}
+			if end < len(tokens) {
+				n.endLine = tokens[end].Span.End.Line
+			}
+			idx = end + 1
+		case lexer.TOKEN_COMMENT:
+			text := "#" + strings.TrimRight(t.Lexeme, " \t\r")
+			if last != nil && last.endLine == t.Span.Start.Line {
+				// NOTE: a comment after a form on the same line stays there
+				last.trailing = " " + text
+				idx += 1
+				continue
+			}
+			n = &fmtNode{text: text, comment: true, line: t.Span.Start.Line, endLine: t.Span.Start.Line}
+			idx += 1
+		default:
+			n = &fmtNode{text: fmtAtom(t), line: t.Span.Start.Line, endLine: t.Span.End.Line}
+			idx += 1
+
+			// NOTE: tokens without space between them are one atom, such as stdio.print
+			for idx < len(tokens) && fmtGlued(tokens[idx-1], tokens[idx]) {
+				n.text += fmtAtom(tokens[idx])
+				idx += 1
+			}
+		}
+
+		if last != nil && n.line > last.endLine+1 {
+			n.blankBefore = true
+		}
+		nodes = append(nodes, n)
+		last = n
+	}
+
+	return nodes, idx
+}
+
+func fmtAtom(t lexer.Token) string {
+	if t.Type == lexer.TOKEN_STRING {
+		return `"` + t.Lexeme + `"`
+	}
+
+	return t.Lexeme
+}
+
+func fmtGlued(prev lexer.Token, next lexer.Token) bool {
+	switch next.Type {
+	case lexer.TOKEN_LEFT_PAREN, lexer.TOKEN_RIGHT_PAREN, lexer.TOKEN_COMMENT:
+		return false
+	}
+
+	return prev.Type != lexer.TOKEN_LEFT_PAREN && prev.Span.End.Offset == next.Span.Start.Offset
+}
+
+func (n *fmtNode) head() string {
+	if len(n.children) == 0 || n.children[0].list {
+		return ""
+	}
+
+	return n.children[0].text
+}
+
+func (n *fmtNode) nested() bool {
+	for _, c := range n.children {
+		if c.list {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fmtFlat renders the node on a single line, unless its layout forbids it
+func fmtFlat(n *fmtNode, parent string) (string, bool) {
+	if !n.list {
+		return n.text, !n.comment
+	}
+
+	head := n.head()
+	switch head {
+	case "@match", "@chain":
+		return "", false
+	case "@var", "@import", "@export":
+		if parent == "@program" || len(n.children) > 2 {
+			return "", false
+		}
+	case "@hash":
+		if len(n.children) > 3 {
+			return "", false
+		}
+	}
+
+	if parent == "@body" && len(n.children) > 1 {
+		return "", false
+	}
+
+	parts := []string{}
+	for idx, c := range n.children {
+		if c.trailing != "" {
+			return "", false
+		}
+
+		str, ok := fmtFlat(c, fmtParent(head, idx))
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, str)
+	}
+
+	return "(" + strings.Join(parts, " ") + ")", true
+}
+
+// fmtRender lays out the node starting at col, on a line indented by indent
+func fmtRender(n *fmtNode, indent int, col int, parent string) string {
+	if !n.list {
+		return n.text
+	}
+
+	if str, ok := fmtFlat(n, parent); ok {
+		if col+len(str) <= FORMAT_WIDTH {
+			return str
+		}
+		if !n.nested() {
+			return fmtFill(n, indent, col)
+		}
+	}
+
+	head := n.head()
+	switch {
+	case parent == "@var" || parent == "@hash":
+		// (name value) and ("key" value)
+		if str, ok := fmtHang(n, 1, indent, col, head); ok {
+			return str
+		}
+	case parent == "@body":
+		return fmtBlock(n, 0, indent, "")
+	case head == "@func" && len(n.children) == 3:
+		if str, ok := fmtHang(n, 2, indent, col, head); ok {
+			return str
+		}
+	case head == "@when" || head == "@catch":
+		if str, ok := fmtHang(n, 2, indent, col, head); ok {
+			return str
+		}
+	case head == "@var" || head == "@import" || head == "@export" || head == "@match" || head == "@chain" || head == "@hash":
+	default:
+		// a call hangs its last argument, when it's broken into a block
+		if str, ok := fmtHang(n, len(n.children)-1, indent, col, head); ok && fmtClosesBlock(str) {
+			return str
+		}
+	}
+
+	keep := 1
+	if head == "" {
+		keep = 0
+	}
+	return fmtBlock(n, keep, indent, head)
+}
+
+// fmtHang keeps the first parts on the line and renders the last part from there
+func fmtHang(n *fmtNode, keep int, indent int, col int, head string) (string, bool) {
+	if keep < 1 || keep != len(n.children)-1 {
+		return "", false
+	}
+
+	parts := []string{}
+	for idx, c := range n.children[:keep] {
+		str, ok := fmtFlat(c, fmtParent(head, idx))
+		if !ok || c.trailing != "" {
+			return "", false
+		}
+		parts = append(parts, str)
+	}
+
+	last := n.children[keep]
+	if last.comment || last.trailing != "" {
+		return "", false
+	}
+
+	prefix := "(" + strings.Join(parts, " ") + " "
+	if col+len(prefix) >= FORMAT_WIDTH {
+		return "", false
+	}
+
+	return prefix + fmtRender(last, indent, col+len(prefix), fmtParent(head, keep)) + ")", true
+}
+
+// fmtClosesBlock reports whether the rendered form ends with a line of closing parens
+func fmtClosesBlock(str string) bool {
+	lines := strings.Split(str, "\n")
+	return len(lines) > 1 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), ")")
+}
+
+// fmtFill wraps a long form of atoms like text, such as a list of numbers
+func fmtFill(n *fmtNode, indent int, col int) string {
+	pad := strings.Repeat("  ", indent+1)
+
+	str := strings.Builder{}
+	str.WriteString("(" + n.children[0].text)
+	col += 1 + len(n.children[0].text)
+	for _, c := range n.children[1:] {
+		if col+1+len(c.text) > FORMAT_WIDTH {
+			str.WriteString("\n" + pad + c.text)
+			col = len(pad) + len(c.text)
+			continue
+		}
+
+		str.WriteString(" " + c.text)
+		col += 1 + len(c.text)
+	}
+	str.WriteString(")")
+
+	return str.String()
+}
+
+// fmtParent is the layout context of the idx-th part of a form
+func fmtParent(head string, idx int) string {
+	if head == "@func" && idx == 2 {
+		return "@body"
+	}
+
+	return head
+}
+
+// fmtBlock keeps the first parts on the opening line and puts every other part on its own line
+func fmtBlock(n *fmtNode, keep int, indent int, head string) string {
+	pad := strings.Repeat("  ", indent+1)
+
+	str := strings.Builder{}
+	str.WriteString("(")
+	for idx, c := range n.children {
+		if idx < keep {
+			if idx > 0 {
+				str.WriteString(" ")
+			}
+			str.WriteString(fmtRender(c, indent, indent*2+1, fmtParent(head, idx)))
+			str.WriteString(c.trailing)
+			continue
+		}
+
+		str.WriteString("\n")
+		if c.blankBefore && idx > keep {
+			str.WriteString("\n")
+		}
+		str.WriteString(pad)
+		str.WriteString(fmtRender(c, indent+1, len(pad), fmtParent(head, idx)))
+		str.WriteString(c.trailing)
+	}
+	str.WriteString("\n" + strings.Repeat("  ", indent) + ")")
+
+	return str.String()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// NOTE: every testdata/fmt/name.toy is formatted into testdata/fmt/name.golden
+func TestFormatGolden(t *testing.T) {
+	scripts, err := filepath.Glob("testdata/fmt/*.toy")
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no scripts to format: %v", err)
+	}
+
+	for _, script := range scripts {
+		name := strings.TrimSuffix(filepath.Base(script), ".toy")
+		t.Run(name, func(t *testing.T) {
+			source, err := os.ReadFile(script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := formatSource(script, string(source))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(script, ".toy") + ".golden"
+			compareGolden(t, golden, got)
+
+			// NOTE: formatted scripts are left as they are
+			again, err := formatSource(golden, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != got {
+				t.Errorf("formatting is not idempotent, formatted again\n%s", again)
+			}
+		})
+	}
+}
+
+func TestFormatWidth(t *testing.T) {
+	got, err := os.ReadFile("testdata/fmt/width.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, line := range strings.Split(string(got), "\n") {
+		if len(line) > FORMAT_WIDTH {
+			t.Errorf("line %d is %d columns wide: %s", idx+1, len(line), line)
+		}
+	}
+}
+
+func TestFormatRejectsSyntaxErrors(t *testing.T) {
+	if _, err := formatSource("bad.toy", "(f ])"); err == nil {
+		t.Error("expected the syntax error to be reported")
+	}
+}
+
+func TestFormatCheck(t *testing.T) {
+	dir := t.TempDir()
+	formatted := filepath.Join(dir, "formatted.toy")
+	unformatted := filepath.Join(dir, "unformatted.toy")
+	for path, source := range map[string]string{formatted: "(stdio.print 1)\n", unformatted: "(stdio.print   1)"} {
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, code := runCommand(t, "fmt", "-check", formatted)
+	if code != 0 || out != "" {
+		t.Errorf("formatted script: got exit code %d with %q, want 0", code, out)
+	}
+
+	out, code = runCommand(t, "fmt", "-check", formatted, unformatted)
+	if code != 1 || out != unformatted+"\n" {
+		t.Errorf("unformatted script: got exit code %d with %q, want 1 listing it", code, out)
+	}
+
+	// NOTE: -check doesn't rewrite, without it the script is rewritten
+	if source, _ := os.ReadFile(unformatted); string(source) != "(stdio.print   1)" {
+		t.Errorf("-check rewrote the script: %q", source)
+	}
+	if _, code := runCommand(t, "fmt", unformatted); code != 0 {
+		t.Errorf("got exit code %d rewriting the script", code)
+	}
+	if out, code := runCommand(t, "fmt", "-check", unformatted); code != 0 {
+		t.Errorf("rewritten script: got exit code %d with %q", code, out)
+	}
+}
+
+// NOTE: the scripts of the repo are kept in the canonical layout
+func TestBenchScriptsFormatted(t *testing.T) {
+	scripts, err := filepath.Glob("../../examples/bench/*.toy")
+	if err != nil || len(scripts) == 0 {
+		t.Fatalf("no bench scripts: %v", err)
+	}
+
+	out, code := runCommand(t, append([]string{"fmt", "-check"}, scripts...)...)
+	if code != 0 {
+		t.Errorf("unformatted scripts:\n%s", out)
+	}
+}
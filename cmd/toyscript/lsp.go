@@ -0,0 +1,745 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"toyscript/ast"
+	"toyscript/interpreter"
+	"toyscript/lexer"
+	"toyscript/parser"
+)
+
+// NOTE: the language server keeps every open document parsed,
+// positions are converted between the byte columns of the scanner
+// and the 0 based UTF-16 columns of the protocol.
+
+type (
+	// lspServer speaks the Language Server Protocol over Content-Length framed JSON-RPC
+	lspServer struct {
+		in        *bufio.Reader
+		out       io.Writer
+		documents map[string]*lspDocument
+		shutdown  bool
+	}
+
+	lspMessage struct {
+		ID     json.RawMessage `json:"id,omitempty"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	lspResponseError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	// lspPosition is 0 based, Character counts UTF-16 code units as the protocol does by default
+	lspPosition struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+
+	lspRange struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	}
+
+	lspLocation struct {
+		URI   string   `json:"uri"`
+		Range lspRange `json:"range"`
+	}
+
+	// lspDocumentParams covers the params of all requests and notifications on a document
+	lspDocumentParams struct {
+		TextDocument struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		} `json:"textDocument"`
+		Position       lspPosition `json:"position"`
+		ContentChanges []struct {
+			Text string `json:"text"`
+		} `json:"contentChanges"`
+	}
+
+	// lspDocument is an open script with its tokens, AST and index
+	lspDocument struct {
+		uri         string
+		source      string
+		lineStarts  []int
+		program     ast.ProgramStatement
+		diagnostics []parser.Diagnostic
+		index       *lspIndex
+	}
+
+	// lspDefinition is where a name is bound, fn is set when it's bound to a func literal
+	lspDefinition struct {
+		name  string
+		kind  string
+		span  lexer.Span
+		outer lexer.Span
+		fn    *ast.FuncLiteral
+	}
+
+	// lspRef is a reference in the document and the definition it resolves to, if any
+	lspRef struct {
+		ref *ast.ReferenceExpression
+		def *lspDefinition
+	}
+
+	// lspIndex resolves the references of a document, following the scoping of the interpreter
+	lspIndex struct {
+		scopes  []map[string]*lspDefinition
+		globals map[string]*lspDefinition
+		imports map[string]string
+		refs    []lspRef
+		symbols []*lspDefinition
+	}
+)
+
+const (
+	LSP_PARSE_ERROR      = -32700
+	LSP_METHOD_NOT_FOUND = -32601
+	LSP_INVALID_PARAMS   = -32602
+	LSP_INVALID_REQUEST  = -32600
+
+	LSP_SEVERITY_ERROR = 1
+
+	LSP_SYMBOL_MODULE   = 2
+	LSP_SYMBOL_FUNCTION = 12
+	LSP_SYMBOL_VARIABLE = 13
+
+	LSP_COMPLETION_FUNCTION = 3
+	LSP_COMPLETION_VARIABLE = 6
+	LSP_COMPLETION_KEYWORD  = 14
+)
+
+// lspForms are the special forms handled by the parser rather than the built-ins
+var lspForms = []string{
+	"@var", "@func", "@list", "@hash", "@match", "@when", "@seq", "@chain",
+	"@async", "@and", "@or", "@try", "@catch", "@import", "@export", "@stream", "@capacity",
+	"@select", "@default", "@timeout", "@ordered",
+}
+
+// serveLSP answers the requests read from r on w, until the client sends exit
+func serveLSP(r io.Reader, w io.Writer) error {
+	s := &lspServer{
+		in:        bufio.NewReader(r),
+		out:       w,
+		documents: map[string]*lspDocument{},
+	}
+
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("lsp: exit before shutdown")
+			}
+			return nil
+		}
+
+		result, rErr := s.handle(msg)
+		if len(msg.ID) == 0 {
+			// NOTE: notifications are never answered, not even with an error
+			continue
+		}
+
+		if err := s.respond(msg.ID, result, rErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *lspServer) read() (*lspMessage, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("lsp: malformed Content-Length %s", value)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, errors.New("lsp: message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	msg := &lspMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		// NOTE: answered with a null id, as the id can't be known
+		return &lspMessage{ID: json.RawMessage("null"), Method: "$/malformed"}, nil
+	}
+
+	return msg, nil
+}
+
+func (s *lspServer) write(msg map[string]any) error {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *lspServer) respond(id json.RawMessage, result any, err *lspResponseError) error {
+	if err != nil {
+		return s.write(map[string]any{"id": id, "error": err})
+	}
+
+	return s.write(map[string]any{"id": id, "result": result})
+}
+
+func (s *lspServer) notify(method string, params any) error {
+	return s.write(map[string]any{"method": method, "params": params})
+}
+
+func (s *lspServer) handle(msg *lspMessage) (any, *lspResponseError) {
+	switch msg.Method {
+	case "$/malformed":
+		return nil, &lspResponseError{LSP_PARSE_ERROR, "malformed JSON message"}
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"positionEncoding":       "utf-16",
+				"textDocumentSync":       1,
+				"definitionProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"@", "("},
+				},
+			},
+			"serverInfo": map[string]any{"name": "toyscript"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(msg.Method, "textDocument/") {
+		return nil, &lspResponseError{LSP_METHOD_NOT_FOUND, "unknown method " + msg.Method}
+	}
+
+	params := lspDocumentParams{}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, &lspResponseError{LSP_INVALID_PARAMS, err.Error()}
+	}
+	uri := params.TextDocument.URI
+
+	switch msg.Method {
+	case "textDocument/didOpen":
+		s.open(uri, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		// NOTE: documents are synced in full, the last change is the whole text
+		if len(params.ContentChanges) > 0 {
+			s.open(uri, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		delete(s.documents, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": []any{}})
+		return nil, nil
+	}
+
+	doc, ok := s.documents[uri]
+	if !ok {
+		return nil, &lspResponseError{LSP_INVALID_REQUEST, "document is not open " + uri}
+	}
+
+	switch msg.Method {
+	case "textDocument/definition":
+		return s.definition(doc, params.Position), nil
+	case "textDocument/hover":
+		return s.hover(doc, params.Position), nil
+	case "textDocument/completion":
+		return s.completion(doc), nil
+	case "textDocument/documentSymbol":
+		return s.symbols(doc), nil
+	}
+
+	return nil, &lspResponseError{LSP_METHOD_NOT_FOUND, "unknown method " + msg.Method}
+}
+
+// open parses the document and publishes its syntax errors
+func (s *lspServer) open(uri string, source string) {
+	doc := newLSPDocument(uri, source)
+	s.documents[uri] = doc
+
+	diagnostics := []map[string]any{}
+	for _, d := range doc.diagnostics {
+		diagnostics = append(diagnostics, map[string]any{
+			"range":    doc.rangeOf(d.Span),
+			"severity": LSP_SEVERITY_ERROR,
+			"source":   "toyscript",
+			"message":  d.Describe(),
+		})
+	}
+
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+func (s *lspServer) definition(doc *lspDocument, pos lspPosition) any {
+	r, ok := doc.refAt(pos)
+	if !ok {
+		return nil
+	}
+
+	target, def := s.resolve(doc, r)
+	if def == nil {
+		return nil
+	}
+
+	return lspLocation{target.uri, target.rangeOf(def.span)}
+}
+
+func (s *lspServer) hover(doc *lspDocument, pos lspPosition) any {
+	r, ok := doc.refAt(pos)
+	if !ok {
+		return nil
+	}
+
+	text := ""
+	switch {
+	case r.ref.RefType == ast.REF_TYPE_BUILTIN:
+		text = fmt.Sprintf("```toy\n%s\n```\nbuilt-in", r.ref.RefName)
+	default:
+		_, def := s.resolve(doc, r)
+		switch {
+		case def == nil && r.ref.RefType == ast.REF_TYPE_IMPORTED:
+			text = fmt.Sprintf("```toy\n%s\n```\nimported", r.ref.RefName)
+		case def == nil:
+			return nil
+		case def.fn != nil:
+			text = fmt.Sprintf("```toy\n(%s)\n```\nfunc", strings.Join(append([]string{r.ref.RefName}, def.fn.Params...), " "))
+		default:
+			text = fmt.Sprintf("```toy\n%s\n```\n%s", r.ref.RefName, def.kind)
+		}
+	}
+
+	return map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": text},
+		"range":    doc.rangeOf(r.ref.Span),
+	}
+}
+
+func (s *lspServer) completion(doc *lspDocument) any {
+	items := []map[string]any{}
+	for _, name := range interpreter.Builtins() {
+		items = append(items, map[string]any{"label": name, "kind": LSP_COMPLETION_FUNCTION, "detail": "built-in"})
+	}
+	for _, name := range lspForms {
+		items = append(items, map[string]any{"label": name, "kind": LSP_COMPLETION_KEYWORD, "detail": "special form"})
+	}
+	for _, def := range doc.index.symbols {
+		kind := LSP_COMPLETION_VARIABLE
+		if def.fn != nil {
+			kind = LSP_COMPLETION_FUNCTION
+		}
+		items = append(items, map[string]any{"label": def.name, "kind": kind, "detail": def.kind})
+	}
+
+	return map[string]any{"isIncomplete": false, "items": items}
+}
+
+func (s *lspServer) symbols(doc *lspDocument) any {
+	symbols := []map[string]any{}
+	for _, def := range doc.index.symbols {
+		kind := LSP_SYMBOL_VARIABLE
+		switch {
+		case def.kind == "module":
+			kind = LSP_SYMBOL_MODULE
+		case def.fn != nil:
+			kind = LSP_SYMBOL_FUNCTION
+		}
+
+		symbols = append(symbols, map[string]any{
+			"name":           def.name,
+			"kind":           kind,
+			"range":          doc.rangeOf(def.outer),
+			"selectionRange": doc.rangeOf(def.span),
+		})
+	}
+
+	return symbols
+}
+
+// Resolve finds the definition of the ref and the document it's in,
+// imported refs are resolved to the top-level bindings of the module
+func (s *lspServer) resolve(doc *lspDocument, r lspRef) (*lspDocument, *lspDefinition) {
+	if r.ref.RefType != ast.REF_TYPE_IMPORTED {
+		return doc, r.def
+	}
+
+	alias, member, _ := strings.Cut(r.ref.RefName, ".")
+	path, ok := doc.index.imports[alias]
+	if !ok {
+		return nil, nil
+	}
+	if _, isNative := interpreter.NativeMembers(path); isNative {
+		return nil, nil
+	}
+
+	module := s.module(doc, path)
+	if module == nil {
+		return nil, nil
+	}
+
+	def, ok := module.index.globals[member]
+	if !ok || def.kind == "module" {
+		return nil, nil
+	}
+	return module, def
+}
+
+// module is the open document of a path imported by doc, or the module read from disk
+func (s *lspServer) module(doc *lspDocument, importPath string) *lspDocument {
+	loader := interpreter.NewModuleLoader()
+
+	var path string
+	resolve := func() (err error) {
+		path, err = loader.Resolve(importPath)
+		return err
+	}
+
+	var err error
+	if from := lspPath(doc.uri); from != "" {
+		err = loader.Enter(from, resolve)
+	} else {
+		err = resolve()
+	}
+	if err != nil {
+		return nil
+	}
+
+	uri := (&url.URL{Scheme: "file", Path: path}).String()
+	if doc, ok := s.documents[uri]; ok {
+		return doc
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	return newLSPDocument(uri, string(source))
+}
+
+// lspPath is the file path of a file:// uri
+func lspPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+
+	return u.Path
+}
+
+func newLSPDocument(uri string, source string) *lspDocument {
+	doc := &lspDocument{uri: uri, source: source, lineStarts: []int{0}}
+	for idx, c := range source {
+		if c == '\n' {
+			doc.lineStarts = append(doc.lineStarts, idx+1)
+		}
+	}
+
+	tokens, _ := lexer.NewScanner(source).ScanTokens()
+	doc.program, doc.diagnostics = parser.NewParser(tokens).Parse()
+
+	doc.index = &lspIndex{imports: map[string]string{}}
+	doc.program.Accept(doc.index)
+
+	return doc
+}
+
+// position converts a scanner position to a protocol position
+func (d *lspDocument) position(p lexer.Position) lspPosition {
+	line := max(p.Line-1, 0)
+	if line >= len(d.lineStarts) {
+		return lspPosition{line, 0}
+	}
+
+	start := d.lineStarts[line]
+	end := min(start+max(p.Column-1, 0), len(d.source))
+
+	return lspPosition{line, len(utf16.Encode([]rune(d.source[start:end])))}
+}
+
+// offset converts a protocol position to a byte offset in the source
+func (d *lspDocument) offset(p lspPosition) int {
+	if p.Line < 0 || p.Line >= len(d.lineStarts) {
+		return -1
+	}
+
+	offset := d.lineStarts[p.Line]
+	for units := 0; units < p.Character && offset < len(d.source); {
+		r, size := utf8.DecodeRuneInString(d.source[offset:])
+		if r == '\n' {
+			break
+		}
+		units += utf16.RuneLen(r)
+		offset += size
+	}
+
+	return offset
+}
+
+func (d *lspDocument) rangeOf(s lexer.Span) lspRange {
+	return lspRange{d.position(s.Start), d.position(s.End)}
+}
+
+// refAt finds the reference under the cursor, including the cursor right after it
+func (d *lspDocument) refAt(p lspPosition) (lspRef, bool) {
+	offset := d.offset(p)
+	for _, r := range d.index.refs {
+		if r.ref.Span.Start.Offset <= offset && offset <= r.ref.Span.End.Offset {
+			return r, true
+		}
+	}
+
+	return lspRef{}, false
+}
+
+// block visits the nodes in a new scope with defs and the @var bindings of the block,
+// the bindings are filled in once their @var is visited
+func (x *lspIndex) block(defs []*lspDefinition, nodes ...ast.Node) map[string]*lspDefinition {
+	scope := map[string]*lspDefinition{}
+	for _, def := range defs {
+		scope[def.name] = def
+	}
+	for _, name := range ast.BlockBindings(nodes...) {
+		if _, ok := scope[name]; !ok {
+			scope[name] = &lspDefinition{name: name, kind: "variable"}
+		}
+	}
+
+	x.scopes = append(x.scopes, scope)
+	x.visit(nodes...)
+	x.scopes = x.scopes[:len(x.scopes)-1]
+
+	return scope
+}
+
+func (x *lspIndex) visit(nodes ...ast.Node) any {
+	for _, n := range nodes {
+		n.Accept(x)
+	}
+	return nil
+}
+
+func (x *lspIndex) lookup(name string) *lspDefinition {
+	for idx := len(x.scopes) - 1; idx >= 0; idx -= 1 {
+		if def, ok := x.scopes[idx][name]; ok {
+			return def
+		}
+	}
+
+	return nil
+}
+
+func (x *lspIndex) VisitString(n *ast.StringLiteral) any {
+	return nil
+}
+
+func (x *lspIndex) VisitNumber(n *ast.NumberLiteral) any {
+	return nil
+}
+
+func (x *lspIndex) VisitBoolean(n *ast.BooleanLiteral) any {
+	return nil
+}
+
+func (x *lspIndex) VisitList(n *ast.ListLiteral) any {
+	return x.visit(n.Elements...)
+}
+
+func (x *lspIndex) VisitHash(n *ast.HashLiteral) any {
+	for _, el := range n.Elements {
+		x.visit(el.Value)
+	}
+	return nil
+}
+
+func (x *lspIndex) VisitStream(n *ast.StreamLiteral) any {
+	if n.Capacity != nil {
+		x.visit(n.Capacity)
+	}
+	return x.visit(n.Values...)
+}
+
+func (x *lspIndex) VisitFunc(n *ast.FuncLiteral) any {
+	defs := []*lspDefinition{}
+	for idx, name := range n.Params {
+		span := n.ParamSpans[idx]
+		defs = append(defs, &lspDefinition{name: name, kind: "param", span: span, outer: span})
+	}
+
+	x.block(defs, n.Body...)
+	return nil
+}
+
+func (x *lspIndex) VisitProgram(n *ast.ProgramStatement) any {
+	// NOTE: imports are always global, so they're bound up front
+	defs := []*lspDefinition{}
+	for _, s := range n.Body {
+		imprt, ok := s.(*ast.ImportStatement)
+		if !ok {
+			continue
+		}
+
+		aliases := slices.SortedFunc(maps.Keys(imprt.Imports), func(a, b string) int {
+			return imprt.AliasSpans[a].Start.Offset - imprt.AliasSpans[b].Start.Offset
+		})
+		for _, alias := range aliases {
+			span := imprt.AliasSpans[alias]
+			def := &lspDefinition{name: alias, kind: "module", span: span, outer: span}
+			x.imports[alias] = imprt.Imports[alias]
+			x.symbols = append(x.symbols, def)
+			defs = append(defs, def)
+		}
+	}
+
+	x.globals = x.block(defs, n.Body...)
+	return nil
+}
+
+func (x *lspIndex) VisitVar(n *ast.VarStatement) any {
+	scope := x.scopes[len(x.scopes)-1]
+	for _, b := range n.Vars {
+		def, ok := scope[b.Name]
+		if !ok || def.span != (lexer.Span{}) {
+			def = &lspDefinition{name: b.Name, kind: "variable"}
+			scope[b.Name] = def
+		}
+		def.fn, _ = b.Value.(*ast.FuncLiteral)
+		def.span, def.outer = b.NameSpan, b.Span
+		if len(x.scopes) == 1 {
+			x.symbols = append(x.symbols, def)
+		}
+
+		x.visit(b.Value)
+	}
+	return nil
+}
+
+func (x *lspIndex) VisitImport(n *ast.ImportStatement) any {
+	return nil
+}
+
+func (x *lspIndex) VisitExport(n *ast.ExportStatement) any {
+	return x.visit(n.Exports...)
+}
+
+func (x *lspIndex) VisitRef(n *ast.ReferenceExpression) any {
+	r := lspRef{ref: n}
+	if n.RefType == ast.REF_TYPE_DECLARED {
+		r.def = x.lookup(n.RefName)
+	}
+
+	x.refs = append(x.refs, r)
+	return nil
+}
+
+func (x *lspIndex) VisitCall(n *ast.CallExpression) any {
+	x.visit(n.Callee)
+	return x.visit(n.Args...)
+}
+
+func (x *lspIndex) VisitMatch(n *ast.MatchExpression) any {
+	x.visit(n.Cond)
+
+	cases := []ast.Node{}
+	for _, mc := range n.Cases {
+		cases = append(cases, mc.When, mc.Then)
+	}
+	value := &lspDefinition{name: "value", kind: "matched value", span: n.Cond.Loc(), outer: n.Span}
+	x.block([]*lspDefinition{value}, cases...)
+	return nil
+}
+
+func (x *lspIndex) VisitMalformed(n *ast.MalformedExpression) any {
+	return nil
+}
+
+func (x *lspIndex) VisitSeq(n *ast.SeqExpression) any {
+	return x.visit(n.Expressions...)
+}
+
+func (x *lspIndex) VisitChain(n *ast.ChainExpression) any {
+	return x.visit(n.Expressions...)
+}
+
+func (x *lspIndex) VisitAsync(n *ast.AsyncExpression) any {
+	for _, e := range n.Expressions {
+		x.block(nil, e)
+	}
+	return nil
+}
+
+func (x *lspIndex) VisitLogical(n *ast.LogicalExpression) any {
+	return x.visit(n.Operands...)
+}
+
+func (x *lspIndex) VisitTry(n *ast.TryExpression) any {
+	x.visit(n.Body)
+
+	def := &lspDefinition{name: n.ErrName, kind: "error", span: n.ErrSpan, outer: n.ErrSpan}
+	x.block([]*lspDefinition{def}, n.Handler)
+	return nil
+}
+
+func (x *lspIndex) VisitSelect(n *ast.SelectExpression) any {
+	for _, sc := range n.Cases {
+		x.visit(sc.Stream)
+		value := &lspDefinition{name: "value", kind: "selected value", span: sc.Stream.Loc(), outer: sc.Stream.Loc()}
+		x.block([]*lspDefinition{value}, sc.Then)
+	}
+	if n.Default != nil {
+		x.block(nil, n.Default)
+	}
+	if n.Timeout != nil {
+		x.visit(n.Timeout.After)
+		x.block(nil, n.Timeout.Then)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// lspClient drives the server over pipes, like an editor would
+type lspClient struct {
+	t    *testing.T
+	in   io.Writer
+	out  *bufio.Reader
+	done chan error
+	id   int
+}
+
+func newLSPClient(t *testing.T) *lspClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+
+	c := &lspClient{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1)}
+	go func() {
+		err := serveLSP(inR, outW)
+		outW.Close()
+		c.done <- err
+	}()
+
+	return c
+}
+
+func (c *lspClient) send(msg map[string]any) {
+	c.t.Helper()
+
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *lspClient) read() map[string]any {
+	c.t.Helper()
+
+	header, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.out, body); err != nil {
+		c.t.Fatal(err)
+	}
+
+	msg := map[string]any{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// request sends a request and returns the result of its response
+func (c *lspClient) request(method string, params any) any {
+	c.t.Helper()
+
+	c.id += 1
+	c.send(map[string]any{"id": c.id, "method": method, "params": params})
+
+	msg := c.read()
+	if msg["id"] != float64(c.id) {
+		c.t.Fatalf("%s: expected the response to %d, got %v", method, c.id, msg)
+	}
+	if msg["error"] != nil {
+		c.t.Fatalf("%s: %v", method, msg["error"])
+	}
+	return msg["result"]
+}
+
+// notify sends a notification and returns the diagnostics published for it
+func (c *lspClient) notify(method string, params any) []any {
+	c.t.Helper()
+
+	c.send(map[string]any{"method": method, "params": params})
+
+	msg := c.read()
+	if msg["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("%s: expected diagnostics, got %v", method, msg)
+	}
+	return msg["params"].(map[string]any)["diagnostics"].([]any)
+}
+
+// at is the params of a request on a position of the document
+func at(uri string, line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+// span renders a protocol range as line:character-line:character
+func span(r any) string {
+	rng := r.(map[string]any)
+	pos := func(p any) string {
+		m := p.(map[string]any)
+		return fmt.Sprintf("%v:%v", m["line"], m["character"])
+	}
+	return pos(rng["start"]) + "-" + pos(rng["end"])
+}
+
+func TestServeLSP(t *testing.T) {
+	const uri = "file:///tmp/lsp_test.toy"
+	// NOTE: the emoji is 4 bytes but 2 UTF-16 code units,
+	// so the refs after it are at different byte and protocol columns
+	source := strings.Join([]string{
+		`(@var (s "😀") (t s))`,
+		`(@var (add (@func (a b) ((+ a b)))))`,
+		`(add t 2)`,
+	}, "\n")
+
+	c := newLSPClient(t)
+
+	caps := c.request("initialize", map[string]any{})
+	if caps.(map[string]any)["capabilities"].(map[string]any)["definitionProvider"] != true {
+		t.Errorf("expected the definition capability, got %v", caps)
+	}
+
+	diagnostics := c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "toy", "version": 1, "text": source},
+	})
+	if len(diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diagnostics)
+	}
+
+	definitions := []struct {
+		line, character int
+		want            string
+	}{
+		{0, 18, "0:7-0:8"},   // s after the emoji
+		{2, 1, "1:7-1:10"},   // add
+		{2, 5, "0:16-0:17"},  // t
+		{1, 28, "1:19-1:20"}, // the param a
+	}
+	for _, d := range definitions {
+		loc := c.request("textDocument/definition", at(uri, d.line, d.character))
+		if loc == nil {
+			t.Errorf("%d:%d: no definition", d.line, d.character)
+			continue
+		}
+		if got := span(loc.(map[string]any)["range"]); got != d.want {
+			t.Errorf("%d:%d: definition at %s, want %s", d.line, d.character, got, d.want)
+		}
+	}
+
+	hover := c.request("textDocument/hover", at(uri, 2, 2)).(map[string]any)
+	value := hover["contents"].(map[string]any)["value"].(string)
+	if !strings.Contains(value, "(add a b)") {
+		t.Errorf("expected the params of add in the hover, got %q", value)
+	}
+	if got := span(hover["range"]); got != "2:1-2:4" {
+		t.Errorf("hover range %s, want 2:1-2:4", got)
+	}
+
+	hover = c.request("textDocument/hover", at(uri, 0, 18)).(map[string]any)
+	if got := span(hover["range"]); got != "0:18-0:19" {
+		t.Errorf("hover range %s, want 0:18-0:19", got)
+	}
+
+	diagnostics = c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []any{map[string]any{"text": `(@var (s "😀") (é 1))`}},
+	})
+	if len(diagnostics) == 0 {
+		t.Fatal("expected the syntax error to be published")
+	}
+	if got := span(diagnostics[0].(map[string]any)["range"]); got != "0:16-0:17" {
+		t.Errorf("diagnostic range %s, want 0:16-0:17", got)
+	}
+
+	if result := c.request("shutdown", nil); result != nil {
+		t.Errorf("expected a null shutdown result, got %v", result)
+	}
+	c.send(map[string]any{"method": "exit"})
+
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
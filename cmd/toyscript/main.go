@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"toyscript/interpreter"
+	"toyscript/lexer"
+	"toyscript/parser"
+)
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) == 1 {
+		err := runPrompt(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	cmd := os.Args[1]
+	flags := flag.NewFlagSet(cmd, flag.ExitOnError)
+	switch cmd {
+	case "run":
+		engine := flags.String("engine", interpreter.ENGINE_TREE, "execution engine: tree | vm")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			log.Fatalln("Usage: toyscript run [-engine tree|vm] [script]")
+		}
+
+		err := runScript(flags.Arg(0), *engine)
+		if err != nil {
+			log.Fatalln(interpreter.DescribeError(err))
+		}
+	case "build":
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			log.Fatalln("Usage: toyscript build [script]\nCompiles the script and its file imports into a .toyc artifact")
+		}
+
+		outPath, err := interpreter.BuildScript(flags.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println("built", outPath)
+	case "tokens", "ast":
+		flags.Parse(os.Args[2:])
+		if flags.NArg() != 1 {
+			log.Fatalf("Usage: toyscript %s [script]\n", cmd)
+		}
+
+		source, err := os.ReadFile(flags.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if cmd == "tokens" {
+			err = dumpTokens(os.Stdout, string(source))
+		} else {
+			err = dumpAST(os.Stdout, flags.Arg(0), string(source))
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+	case "check":
+		flags.Parse(os.Args[2:])
+		if flags.NArg() == 0 {
+			log.Fatalln("Usage: toyscript check [script...]")
+		}
+
+		if !checkScripts(flags.Args()) {
+			os.Exit(1)
+		}
+	case "lsp":
+		flags.Parse(os.Args[2:])
+
+		err := serveLSP(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	case "fmt":
+		check := flags.Bool("check", false, "report unformatted files instead of rewriting them")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() == 0 {
+			log.Fatalln("Usage: toyscript fmt [-check] [script...]")
+		}
+
+		if !formatScripts(flags.Args(), *check) {
+			os.Exit(1)
+		}
+	case "bench":
+		runs := flags.Int("n", 10, "number of runs per engine")
+		flags.Parse(os.Args[2:])
+		if flags.NArg() == 0 {
+			log.Fatalln("Usage: toyscript bench [-n runs] [script...]")
+		}
+
+		for _, path := range flags.Args() {
+			err := benchScript(path, *runs)
+			if err != nil {
+				log.Fatalln(interpreter.DescribeError(err))
+			}
+		}
+	default:
+		log.Fatalf("Unknown command %s.\nSupported commands are: run | build | check | fmt | tokens | ast | lsp | bench\n", cmd)
+	}
+}
+
+func runScript(filename string, engine string) error {
+	script, err := interpreter.LoadScript(filename)
+	if err != nil {
+		return err
+	}
+
+	evaler, err := interpreter.NewEngine(engine)
+	if err != nil {
+		return err
+	}
+
+	script.Preload(evaler)
+	return evaler.Exec(filename, script.Program)
+}
+
+func runPrompt(in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, "debel-toy-lang v0.0.1")
+
+	// NOTE: a single interpreter so vars and imports survive between inputs
+	repl := interpreter.NewInterpreter(map[string]any{})
+	reader := bufio.NewReader(in)
+	input := strings.Builder{}
+	for {
+		if input.Len() == 0 {
+			fmt.Fprint(out, "> ")
+		} else {
+			fmt.Fprint(out, ". ")
+		}
+
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			fmt.Fprintln(out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if input.Len() == 0 {
+			switch strings.TrimSpace(line) {
+			case "exit":
+				return nil
+			case "":
+				continue
+			}
+		}
+
+		// NOTE: keep reading lines until all open forms are closed
+		input.WriteString(line)
+		if !isComplete(input.String()) {
+			continue
+		}
+
+		source := input.String()
+		input.Reset()
+
+		program, err := parser.ParseInput("<stdin>", source)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+
+		value, err := repl.Eval(program)
+		if err != nil {
+			fmt.Fprintln(out, interpreter.DescribeError(err))
+			continue
+		}
+
+		if value != nil {
+			fmt.Fprintln(out, interpreter.FormatValue(value))
+		}
+	}
+}
+
+// isComplete reports whether all forms in source are closed
+func isComplete(source string) bool {
+	tokens, _ := lexer.NewScanner(source).ScanTokens()
+
+	depth := 0
+	for _, t := range tokens {
+		switch t.Type {
+		case lexer.TOKEN_LEFT_PAREN:
+			depth += 1
+		case lexer.TOKEN_RIGHT_PAREN:
+			depth -= 1
+		case lexer.TOKEN_ERROR:
+			if t.Lexeme == "Unterminated string" {
+				return false
+			}
+		}
+	}
+
+	return depth <= 0
+}
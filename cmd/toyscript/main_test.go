@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// NOTE: commands which exit are run as a child process of the test binary,
+// which runs main instead of the tests when TOYSCRIPT_MAIN is set
+func TestMain(m *testing.M) {
+	if os.Getenv("TOYSCRIPT_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// runCommand runs toyscript with the args and returns its stdout and exit code
+func runCommand(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "TOYSCRIPT_MAIN=1")
+	out, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out), 0
+}
+
+// compareGolden compares got with the golden file, rewriting it with -update
+func compareGolden(t *testing.T, golden string, got string) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s doesn't match, got\n%s", golden, got)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{"atoms and refs", []string{`(@var (x 41))`, `x`, `42`, `"s"`, `true`}, []string{"41", "42", `"s"`, "true"}},
+		{"multi-line forms", []string{`(+ 1`, `  2`, `  3)`, `(@list`, `"a")`}, []string{"6", `(@list "a")`}},
+		{"state between inputs", []string{`(@var (add (@func (a b) ((+ a b)))))`, `(@var (y (add 1 2)))`, `(add y 1)`}, []string{"4"}},
+		{"runtime errors", []string{`(@var (x 1))`, `(/ x 0)`, `z`, `x`}, []string{
+			"error: /: division by zero",
+			"  at / (line 1, column 1)",
+			"error: failed to resolve ref z (declared)",
+			"1",
+		}},
+		{"syntax errors", []string{`)`, `(f ])`, `(+ 1 2)`}, []string{
+			"<stdin>:1:1: error: unexpected ')' in statement",
+			"   1 | )",
+			"     | ^",
+			"1 syntax error",
+			"<stdin>:1:4: error: unexpected character ']'",
+			"   1 | (f ])",
+			"     |    ^",
+			"1 syntax error",
+			"3",
+		}},
+		{"blank lines and exit", []string{``, `1`, `exit`, `2`}, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := strings.Builder{}
+			if err := runPrompt(strings.NewReader(strings.Join(tt.input, "\n")+"\n"), &out); err != nil {
+				t.Fatal(err)
+			}
+
+			// NOTE: the prompts aren't followed by a new line, drop them with the banner
+			got := []string{}
+			for _, line := range strings.Split(out.String(), "\n")[1:] {
+				for strings.HasPrefix(line, "> ") || strings.HasPrefix(line, ". ") {
+					line = line[2:]
+				}
+				if line != "" && line != ">" {
+					got = append(got, line)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,924 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+
+	"toyscript/ast"
+	"toyscript/lexer"
+)
+
+// NOTE: an artifact holds the compiled code of a script and its file imports,
+// the VM runs it as is and the tree-walker runs the syntax trees kept next to it.
+// It's a header followed by a table of modules:
+//
+//	"TOYC" version:uvarint main:string count:uvarint (path:string node proto)*
+//
+// every node is a tag byte, its span and then its fields in declaration order.
+// a proto is its name, params, slots and span followed by its instructions
+// (op:byte a:int b:int c:int position), its tagged constants and its nested protos.
+// strings are length prefixed, lists are count prefixed and ints are zig-zag varints.
+// paths are relative to the directory of the main module, with forward slashes.
+
+type (
+	artifact struct {
+		Main    string
+		Modules map[string]*ast.ProgramStatement
+		Code    map[string]*funcProto
+	}
+
+	nodeTag  = byte
+	constTag = byte
+
+	artifactEncoder struct {
+		buf bytes.Buffer
+		err error
+	}
+
+	artifactDecoder struct {
+		r *bytes.Reader
+	}
+)
+
+const (
+	ARTIFACT_MAGIC   = "TOYC"
+	ARTIFACT_VERSION = 5
+)
+
+const (
+	TAG_STRING nodeTag = iota + 1
+	TAG_INT
+	TAG_FLOAT
+	TAG_BOOLEAN
+	TAG_LIST
+	TAG_HASH
+	TAG_FUNC
+	TAG_PROGRAM
+	TAG_VAR
+	TAG_IMPORT
+	TAG_EXPORT
+	TAG_REF
+	TAG_CALL
+	TAG_MATCH
+	TAG_SEQ
+	TAG_CHAIN
+	TAG_ASYNC
+	TAG_LOGICAL
+	TAG_TRY
+	TAG_STREAM
+	TAG_SELECT
+)
+
+const (
+	CONST_STRING constTag = iota + 1
+	CONST_INT
+	CONST_FLOAT
+	CONST_BOOLEAN
+	CONST_STRINGS
+	CONST_INTS
+	CONST_IMPORT
+)
+
+func isArtifact(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ARTIFACT_MAGIC))
+}
+
+func writeArtifact(w io.Writer, a *artifact) error {
+	e := &artifactEncoder{}
+	e.buf.WriteString(ARTIFACT_MAGIC)
+	e.uint(ARTIFACT_VERSION)
+	e.string(a.Main)
+
+	e.uint(uint64(len(a.Modules)))
+	for _, path := range slices.Sorted(maps.Keys(a.Modules)) {
+		e.string(path)
+		e.node(a.Modules[path])
+		e.proto(a.Code[path])
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+func readArtifact(data []byte) (*artifact, error) {
+	if !isArtifact(data) {
+		return nil, errors.New("not a compiled toy-script artifact")
+	}
+
+	d := &artifactDecoder{bytes.NewReader(data[len(ARTIFACT_MAGIC):])}
+	version, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	if version != ARTIFACT_VERSION {
+		return nil, fmt.Errorf("unsupported artifact version %d, expected %d", version, ARTIFACT_VERSION)
+	}
+
+	a := &artifact{Modules: map[string]*ast.ProgramStatement{}, Code: map[string]*funcProto{}}
+	a.Main, err = d.string()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+
+	for range count {
+		path, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := d.node()
+		if err != nil {
+			return nil, err
+		}
+
+		program, ok := n.(*ast.ProgramStatement)
+		if !ok {
+			return nil, fmt.Errorf("module %s is not a program", path)
+		}
+		a.Modules[path] = program
+
+		a.Code[path], err = d.proto()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := a.Modules[a.Main]; !ok {
+		return nil, fmt.Errorf("artifact is missing its main module %s", a.Main)
+	}
+
+	return a, nil
+}
+
+// ENCODER
+
+func (e *artifactEncoder) uint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *artifactEncoder) int(v int) {
+	e.buf.Write(binary.AppendVarint(nil, int64(v)))
+}
+
+func (e *artifactEncoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *artifactEncoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *artifactEncoder) float(f float64) {
+	e.buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (e *artifactEncoder) position(p lexer.Position) {
+	e.uint(uint64(p.Line))
+	e.uint(uint64(p.Column))
+	e.uint(uint64(p.Offset))
+}
+
+func (e *artifactEncoder) span(s lexer.Span) {
+	e.position(s.Start)
+	e.position(s.End)
+}
+
+func (e *artifactEncoder) proto(p *funcProto) {
+	e.string(p.name)
+	e.uint(uint64(p.params))
+	e.uint(uint64(p.slots))
+	e.span(p.span)
+
+	e.uint(uint64(len(p.code)))
+	for _, in := range p.code {
+		e.buf.WriteByte(in.op)
+		e.int(in.a)
+		e.int(in.b)
+		e.int(in.c)
+		e.position(in.pos)
+	}
+
+	e.uint(uint64(len(p.consts)))
+	for _, c := range p.consts {
+		e.constant(c)
+	}
+
+	e.uint(uint64(len(p.protos)))
+	for _, child := range p.protos {
+		e.proto(child)
+	}
+}
+
+func (e *artifactEncoder) constant(v any) {
+	switch c := v.(type) {
+	case string:
+		e.buf.WriteByte(CONST_STRING)
+		e.string(c)
+	case int:
+		e.buf.WriteByte(CONST_INT)
+		e.int(c)
+	case float64:
+		e.buf.WriteByte(CONST_FLOAT)
+		e.float(c)
+	case bool:
+		e.buf.WriteByte(CONST_BOOLEAN)
+		e.bool(c)
+	case []string:
+		e.buf.WriteByte(CONST_STRINGS)
+		e.uint(uint64(len(c)))
+		for _, s := range c {
+			e.string(s)
+		}
+	case []int:
+		e.buf.WriteByte(CONST_INTS)
+		e.uint(uint64(len(c)))
+		for _, i := range c {
+			e.int(i)
+		}
+	case *ast.ImportStatement:
+		e.buf.WriteByte(CONST_IMPORT)
+		e.node(c)
+	default:
+		e.err = fmt.Errorf("cannot encode constant %T", v)
+	}
+}
+
+func (e *artifactEncoder) tagged(tag nodeTag, s lexer.Span) {
+	e.buf.WriteByte(tag)
+	e.span(s)
+}
+
+func (e *artifactEncoder) node(n ast.Node) {
+	n.Accept(e)
+}
+
+func (e *artifactEncoder) nodes(ns []ast.Node) {
+	e.uint(uint64(len(ns)))
+	for _, n := range ns {
+		e.node(n)
+	}
+}
+
+func (e *artifactEncoder) VisitString(n *ast.StringLiteral) any {
+	e.tagged(TAG_STRING, n.Span)
+	e.string(n.Value)
+	return nil
+}
+
+func (e *artifactEncoder) VisitNumber(n *ast.NumberLiteral) any {
+	switch v := n.Value.(type) {
+	case int:
+		e.tagged(TAG_INT, n.Span)
+		e.int(v)
+	case float64:
+		e.tagged(TAG_FLOAT, n.Span)
+		e.float(v)
+	default:
+		e.err = fmt.Errorf("cannot encode number %v", n.Value)
+	}
+	return nil
+}
+
+func (e *artifactEncoder) VisitBoolean(n *ast.BooleanLiteral) any {
+	e.tagged(TAG_BOOLEAN, n.Span)
+	e.bool(n.Value)
+	return nil
+}
+
+func (e *artifactEncoder) VisitList(n *ast.ListLiteral) any {
+	e.tagged(TAG_LIST, n.Span)
+	e.nodes(n.Elements)
+	return nil
+}
+
+func (e *artifactEncoder) VisitHash(n *ast.HashLiteral) any {
+	e.tagged(TAG_HASH, n.Span)
+	e.uint(uint64(len(n.Elements)))
+	for _, el := range n.Elements {
+		e.string(el.Key)
+		e.node(el.Value)
+	}
+	return nil
+}
+
+func (e *artifactEncoder) VisitStream(n *ast.StreamLiteral) any {
+	// NOTE: the optional capacity is a list of zero or one nodes
+	capacity := []ast.Node{}
+	if n.Capacity != nil {
+		capacity = append(capacity, n.Capacity)
+	}
+
+	e.tagged(TAG_STREAM, n.Span)
+	e.nodes(capacity)
+	e.nodes(n.Values)
+	return nil
+}
+
+func (e *artifactEncoder) VisitFunc(n *ast.FuncLiteral) any {
+	e.tagged(TAG_FUNC, n.Span)
+	e.uint(uint64(len(n.Params)))
+	for _, p := range n.Params {
+		e.string(p)
+	}
+	e.nodes(n.Body)
+	return nil
+}
+
+func (e *artifactEncoder) VisitProgram(n *ast.ProgramStatement) any {
+	e.tagged(TAG_PROGRAM, n.Span)
+	e.nodes(n.Body)
+	return nil
+}
+
+func (e *artifactEncoder) VisitVar(n *ast.VarStatement) any {
+	e.tagged(TAG_VAR, n.Span)
+	e.uint(uint64(len(n.Vars)))
+	for _, b := range n.Vars {
+		e.string(b.Name)
+		e.node(b.Value)
+	}
+	return nil
+}
+
+func (e *artifactEncoder) VisitImport(n *ast.ImportStatement) any {
+	e.tagged(TAG_IMPORT, n.Span)
+	e.uint(uint64(len(n.Imports)))
+	for _, alias := range slices.Sorted(maps.Keys(n.Imports)) {
+		e.string(alias)
+		e.string(n.Imports[alias])
+	}
+	return nil
+}
+
+func (e *artifactEncoder) VisitExport(n *ast.ExportStatement) any {
+	e.tagged(TAG_EXPORT, n.Span)
+	e.nodes(n.Exports)
+	return nil
+}
+
+func (e *artifactEncoder) VisitRef(n *ast.ReferenceExpression) any {
+	e.tagged(TAG_REF, n.Span)
+	e.string(n.RefName)
+	e.string(n.RefType)
+	return nil
+}
+
+func (e *artifactEncoder) VisitCall(n *ast.CallExpression) any {
+	e.tagged(TAG_CALL, n.Span)
+	e.node(n.Callee)
+	e.nodes(n.Args)
+	return nil
+}
+
+func (e *artifactEncoder) VisitMatch(n *ast.MatchExpression) any {
+	e.tagged(TAG_MATCH, n.Span)
+	e.node(n.Cond)
+	e.uint(uint64(len(n.Cases)))
+	for _, c := range n.Cases {
+		e.node(c.When)
+		e.node(c.Then)
+	}
+	return nil
+}
+
+func (e *artifactEncoder) VisitMalformed(n *ast.MalformedExpression) any {
+	e.err = fmt.Errorf("cannot encode malformed expression at %s: %s", n.Span.Start, n.Error)
+	return nil
+}
+
+func (e *artifactEncoder) VisitSeq(n *ast.SeqExpression) any {
+	e.tagged(TAG_SEQ, n.Span)
+	e.nodes(n.Expressions)
+	return nil
+}
+
+func (e *artifactEncoder) VisitChain(n *ast.ChainExpression) any {
+	e.tagged(TAG_CHAIN, n.Span)
+	e.nodes(n.Expressions)
+	return nil
+}
+
+func (e *artifactEncoder) VisitAsync(n *ast.AsyncExpression) any {
+	e.tagged(TAG_ASYNC, n.Span)
+	e.bool(n.Ordered)
+	e.nodes(n.Expressions)
+	return nil
+}
+
+func (e *artifactEncoder) VisitLogical(n *ast.LogicalExpression) any {
+	e.tagged(TAG_LOGICAL, n.Span)
+	e.string(n.Operator)
+	e.nodes(n.Operands)
+	return nil
+}
+
+func (e *artifactEncoder) VisitSelect(n *ast.SelectExpression) any {
+	e.tagged(TAG_SELECT, n.Span)
+	e.uint(uint64(len(n.Cases)))
+	for _, c := range n.Cases {
+		e.node(c.Stream)
+		e.node(c.Then)
+	}
+
+	// NOTE: the optional clauses are lists of zero or one default and zero or two timeout nodes
+	def, timeout := []ast.Node{}, []ast.Node{}
+	if n.Default != nil {
+		def = append(def, n.Default)
+	}
+	if n.Timeout != nil {
+		timeout = append(timeout, n.Timeout.After, n.Timeout.Then)
+	}
+	e.nodes(def)
+	e.nodes(timeout)
+	return nil
+}
+
+func (e *artifactEncoder) VisitTry(n *ast.TryExpression) any {
+	e.tagged(TAG_TRY, n.Span)
+	e.node(n.Body)
+	e.string(n.ErrName)
+	e.node(n.Handler)
+	return nil
+}
+
+// DECODER
+
+func (d *artifactDecoder) uint() (uint64, error) {
+	return binary.ReadUvarint(d.r)
+}
+
+func (d *artifactDecoder) int() (int, error) {
+	v, err := binary.ReadVarint(d.r)
+	return int(v), err
+}
+
+func (d *artifactDecoder) count() (int, error) {
+	v, err := d.uint()
+	if err != nil {
+		return 0, err
+	}
+
+	// NOTE: every entry takes at least a byte, guard against corrupt lengths
+	if v > uint64(d.r.Len()) {
+		return 0, errors.New("corrupt artifact: length out of range")
+	}
+
+	return int(v), nil
+}
+
+func (d *artifactDecoder) string() (string, error) {
+	n, err := d.count()
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(d.r, b)
+	return string(b), err
+}
+
+func (d *artifactDecoder) strings() ([]string, error) {
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, 0, n)
+	for range n {
+		s, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+
+	return strs, nil
+}
+
+func (d *artifactDecoder) float() (float64, error) {
+	b := make([]byte, 8)
+	_, err := io.ReadFull(d.r, b)
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), err
+}
+
+func (d *artifactDecoder) position() (lexer.Position, error) {
+	vals := [3]int{}
+	for idx := range vals {
+		v, err := d.uint()
+		if err != nil {
+			return lexer.Position{}, err
+		}
+		vals[idx] = int(v)
+	}
+
+	return lexer.Position{Line: vals[0], Column: vals[1], Offset: vals[2]}, nil
+}
+
+func (d *artifactDecoder) span() (lexer.Span, error) {
+	start, err := d.position()
+	if err != nil {
+		return lexer.Span{}, err
+	}
+	end, err := d.position()
+	return lexer.Span{Start: start, End: end}, err
+}
+
+func (d *artifactDecoder) proto() (*funcProto, error) {
+	p := &funcProto{}
+
+	var err error
+	p.name, err = d.string()
+	if err != nil {
+		return nil, err
+	}
+	params, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	slots, err := d.uint()
+	if err != nil {
+		return nil, err
+	}
+	p.params, p.slots = int(params), int(slots)
+	p.span, err = d.span()
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	p.code = make([]instr, 0, n)
+	for range n {
+		in, err := d.instr()
+		if err != nil {
+			return nil, err
+		}
+		p.code = append(p.code, in)
+	}
+
+	n, err = d.count()
+	if err != nil {
+		return nil, err
+	}
+	p.consts = make([]any, 0, n)
+	for range n {
+		c, err := d.constant()
+		if err != nil {
+			return nil, err
+		}
+		p.consts = append(p.consts, c)
+	}
+
+	n, err = d.count()
+	if err != nil {
+		return nil, err
+	}
+	p.protos = make([]*funcProto, 0, n)
+	for range n {
+		child, err := d.proto()
+		if err != nil {
+			return nil, err
+		}
+		p.protos = append(p.protos, child)
+	}
+
+	return p, nil
+}
+
+func (d *artifactDecoder) instr() (instr, error) {
+	op, err := d.r.ReadByte()
+	if err != nil {
+		return instr{}, err
+	}
+	// NOTE: OP_RAISE is the last opcode
+	if op > OP_RAISE {
+		return instr{}, fmt.Errorf("corrupt artifact: unknown opcode %d", op)
+	}
+
+	operands := [3]int{}
+	for idx := range operands {
+		operands[idx], err = d.int()
+		if err != nil {
+			return instr{}, err
+		}
+	}
+
+	pos, err := d.position()
+	return instr{op, operands[0], operands[1], operands[2], pos}, err
+}
+
+func (d *artifactDecoder) constant() (any, error) {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case CONST_STRING:
+		return d.string()
+	case CONST_INT:
+		return d.int()
+	case CONST_FLOAT:
+		return d.float()
+	case CONST_BOOLEAN:
+		b, err := d.r.ReadByte()
+		return b == 1, err
+	case CONST_STRINGS:
+		return d.strings()
+	case CONST_INTS:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+
+		ints := make([]int, 0, n)
+		for range n {
+			i, err := d.int()
+			if err != nil {
+				return nil, err
+			}
+			ints = append(ints, i)
+		}
+		return ints, nil
+	case CONST_IMPORT:
+		n, err := d.node()
+		if err != nil {
+			return nil, err
+		}
+
+		imprt, ok := n.(*ast.ImportStatement)
+		if !ok {
+			return nil, errors.New("corrupt artifact: import constant is not an import")
+		}
+		return imprt, nil
+	}
+
+	return nil, fmt.Errorf("corrupt artifact: unknown constant tag %d", tag)
+}
+
+func (d *artifactDecoder) nodes() ([]ast.Node, error) {
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+
+	ns := make([]ast.Node, 0, n)
+	for range n {
+		child, err := d.node()
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, child)
+	}
+
+	return ns, nil
+}
+
+func (d *artifactDecoder) node() (ast.Node, error) {
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	span, err := d.span()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case TAG_STRING:
+		v, err := d.string()
+		return &ast.StringLiteral{Span: span, Value: v}, err
+	case TAG_INT:
+		v, err := d.int()
+		return &ast.NumberLiteral{Span: span, Value: v}, err
+	case TAG_FLOAT:
+		v, err := d.float()
+		return &ast.NumberLiteral{Span: span, Value: v}, err
+	case TAG_BOOLEAN:
+		b, err := d.r.ReadByte()
+		return &ast.BooleanLiteral{Span: span, Value: b == 1}, err
+	case TAG_LIST:
+		els, err := d.nodes()
+		return &ast.ListLiteral{Span: span, Elements: els}, err
+	case TAG_HASH:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+
+		els := []ast.HashEntry{}
+		for range n {
+			key, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.node()
+			if err != nil {
+				return nil, err
+			}
+			els = append(els, ast.HashEntry{Key: key, Value: value})
+		}
+		return &ast.HashLiteral{Span: span, Elements: els}, nil
+	case TAG_FUNC:
+		params, err := d.strings()
+		if err != nil {
+			return nil, err
+		}
+		body, err := d.nodes()
+		return &ast.FuncLiteral{Span: span, Params: params, Body: body}, err
+	case TAG_PROGRAM:
+		body, err := d.nodes()
+		return &ast.ProgramStatement{Span: span, Body: body}, err
+	case TAG_VAR:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+
+		vars := []ast.VarBinding{}
+		for range n {
+			name, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.node()
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, ast.VarBinding{Name: name, Value: value})
+		}
+		return &ast.VarStatement{Span: span, Vars: vars}, nil
+	case TAG_IMPORT:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+
+		imports := map[string]string{}
+		for range n {
+			alias, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			path, err := d.string()
+			if err != nil {
+				return nil, err
+			}
+			imports[alias] = path
+		}
+		return &ast.ImportStatement{Span: span, Imports: imports}, nil
+	case TAG_EXPORT:
+		exports, err := d.nodes()
+		return &ast.ExportStatement{Span: span, Exports: exports}, err
+	case TAG_REF:
+		name, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		refType, err := d.string()
+		return &ast.ReferenceExpression{Span: span, RefName: name, RefType: refType}, err
+	case TAG_CALL:
+		callee, err := d.node()
+		if err != nil {
+			return nil, err
+		}
+		args, err := d.nodes()
+		return &ast.CallExpression{Span: span, Callee: callee, Args: args}, err
+	case TAG_MATCH:
+		cond, err := d.node()
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+
+		cases := []ast.MatchCase{}
+		for range n {
+			when, err := d.node()
+			if err != nil {
+				return nil, err
+			}
+			then, err := d.node()
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, ast.MatchCase{When: when, Then: then})
+		}
+		return &ast.MatchExpression{Span: span, Cond: cond, Cases: cases}, nil
+	case TAG_SEQ:
+		exprs, err := d.nodes()
+		return &ast.SeqExpression{Span: span, Expressions: exprs}, err
+	case TAG_CHAIN:
+		exprs, err := d.nodes()
+		return &ast.ChainExpression{Span: span, Expressions: exprs}, err
+	case TAG_ASYNC:
+		ordered, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		exprs, err := d.nodes()
+		return &ast.AsyncExpression{Span: span, Ordered: ordered == 1, Expressions: exprs}, err
+	case TAG_LOGICAL:
+		op, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		operands, err := d.nodes()
+		return &ast.LogicalExpression{Span: span, Operator: op, Operands: operands}, err
+	case TAG_TRY:
+		body, err := d.node()
+		if err != nil {
+			return nil, err
+		}
+		errName, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		handler, err := d.node()
+		return &ast.TryExpression{Span: span, Body: body, ErrName: errName, Handler: handler}, err
+	case TAG_STREAM:
+		capacity, err := d.nodes()
+		if err != nil {
+			return nil, err
+		}
+		if len(capacity) > 1 {
+			return nil, errors.New("corrupt artifact: stream with more than one capacity")
+		}
+		values, err := d.nodes()
+		if err != nil {
+			return nil, err
+		}
+
+		stream := &ast.StreamLiteral{Span: span, Values: values}
+		if len(capacity) == 1 {
+			stream.Capacity = capacity[0]
+		}
+		return stream, nil
+	case TAG_SELECT:
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+
+		sel := &ast.SelectExpression{Span: span, Cases: []ast.SelectCase{}}
+		for range n {
+			stream, err := d.node()
+			if err != nil {
+				return nil, err
+			}
+			then, err := d.node()
+			if err != nil {
+				return nil, err
+			}
+			sel.Cases = append(sel.Cases, ast.SelectCase{Stream: stream, Then: then})
+		}
+
+		def, err := d.nodes()
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := d.nodes()
+		if err != nil {
+			return nil, err
+		}
+		if len(def) > 1 || len(timeout) != 0 && len(timeout) != 2 {
+			return nil, errors.New("corrupt artifact: malformed select clauses")
+		}
+
+		if len(def) == 1 {
+			sel.Default = def[0]
+		}
+		if len(timeout) == 2 {
+			sel.Timeout = &ast.SelectTimeout{After: timeout[0], Then: timeout[1]}
+		}
+		return sel, nil
+	}
+
+	return nil, fmt.Errorf("corrupt artifact: unknown node tag %d", tag)
+}
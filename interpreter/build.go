@@ -0,0 +1,180 @@
+package interpreter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"toyscript/ast"
+	"toyscript/parser"
+)
+
+type (
+	// Script is a loaded script and the file modules it imports by their canonical path,
+	// the programs of an artifact come with their compiled code
+	Script struct {
+		Program *ast.ProgramStatement
+		Modules map[string]*ast.ProgramStatement
+		code    map[*ast.ProgramStatement]*funcProto
+	}
+)
+
+// Preload registers the file modules of the script with the engine,
+// a VM also takes their compiled code so it doesn't compile them again
+func (s *Script) Preload(e Engine) {
+	e.Preload(s.Modules)
+
+	if vm, ok := e.(*VM); ok {
+		for p, proto := range s.code {
+			vm.code[p] = proto
+		}
+	}
+}
+
+// BuildScript parses and compiles the script and its file imports into an artifact
+// written next to it, i.e. script.toy is built into script.toyc.
+// Modules are stored by their path relative to the directory of the script.
+func BuildScript(path string) (string, error) {
+	main, err := canonicalPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	modules := map[string]*ast.ProgramStatement{}
+	err = collectModules(NewModuleLoader(), main, modules)
+	if err != nil {
+		return "", err
+	}
+
+	a := &artifact{
+		Main:    filepath.Base(main),
+		Modules: map[string]*ast.ProgramStatement{},
+		Code:    map[string]*funcProto{},
+	}
+	for modulePath, program := range modules {
+		rel, err := filepath.Rel(filepath.Dir(main), modulePath)
+		if err != nil {
+			return "", err
+		}
+		// NOTE: compiled after collecting, once every import is pinned
+		a.Modules[filepath.ToSlash(rel)] = program
+		a.Code[filepath.ToSlash(rel)] = Compile(program)
+	}
+
+	outPath := strings.TrimSuffix(path, ".toy") + ".toyc"
+	out, err := os.Create(outPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	err = writeArtifact(out, a)
+	if err != nil {
+		return "", err
+	}
+
+	return outPath, out.Close()
+}
+
+// collectModules parses the module at the canonical path and, recursively,
+// every file module it imports
+func collectModules(l *ModuleLoader, path string, modules map[string]*ast.ProgramStatement) error {
+	if _, seen := modules[path]; seen {
+		return nil
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	program, err := parser.ParseSource(displayPath(path), string(source))
+	if err != nil {
+		return err
+	}
+	modules[path] = program
+
+	// NOTE: imports of the module are resolved relative to it
+	l.stack = append(l.stack, path)
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+
+	for _, s := range program.Body {
+		imprt, ok := s.(*ast.ImportStatement)
+		if !ok {
+			continue
+		}
+
+		for alias, importPath := range imprt.Imports {
+			if _, isNative := NativeMembers(importPath); isNative {
+				continue
+			}
+
+			resolved, err := l.Resolve(importPath)
+			if err != nil {
+				return err
+			}
+			if err := l.cycle(resolved); err != nil {
+				return err
+			}
+
+			// NOTE: pin the import to the module it resolved to,
+			// so the artifact doesn't depend on the search path it was built with
+			rel, err := filepath.Rel(filepath.Dir(path), resolved)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if !strings.HasPrefix(rel, "../") {
+				rel = "./" + rel
+			}
+			imprt.Imports[alias] = rel
+
+			err = collectModules(l, resolved, modules)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// LoadScript reads either a .toy source or a compiled artifact,
+// the modules of an artifact are loaded with it
+func LoadScript(filename string) (*Script, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Script{Modules: map[string]*ast.ProgramStatement{}, code: map[*ast.ProgramStatement]*funcProto{}}
+	if isArtifact(contents) {
+		a, err := readArtifact(contents)
+		if err != nil {
+			return nil, errors.New(filename + ": " + err.Error())
+		}
+
+		dir, err := canonicalPath(filepath.Dir(filename))
+		if err != nil {
+			return nil, err
+		}
+
+		for path, program := range a.Modules {
+			s.Modules[filepath.Join(dir, filepath.FromSlash(path))] = program
+			s.code[program] = a.Code[path]
+		}
+		s.Program = a.Modules[a.Main]
+
+		return s, nil
+	}
+
+	s.Program, err = parser.ParseSource(filename, string(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
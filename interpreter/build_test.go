@@ -0,0 +1,149 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes the sources into dir by their relative path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, source := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// sameProto compares the code, constants and nested protos of two funcs
+func sameProto(a *funcProto, b *funcProto) bool {
+	if a.name != b.name || a.params != b.params || a.slots != b.slots || a.span != b.span {
+		return false
+	}
+	if !slices.Equal(a.code, b.code) || len(a.consts) != len(b.consts) || len(a.protos) != len(b.protos) {
+		return false
+	}
+	for idx := range a.consts {
+		if !reflect.DeepEqual(a.consts[idx], b.consts[idx]) {
+			return false
+		}
+	}
+	for idx := range a.protos {
+		if !sameProto(a.protos[idx], b.protos[idx]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.toy": `
+			(@import (calc "./lib/calc.toy") (json "std/json"))
+			(@var (total (calc.sum 1 2 3.5)))
+			(@list total (calc.label total) (@len (json.parse "[1, 2, 3]")) (@try (@error "boom") (@catch err (@get err "message"))))`,
+		"lib/calc.toy": `
+			(@var
+			  (sum (@func (a b c) ((+ a b c))))
+			  (label (@func (n) ((@match (> n 5) (@when true "big") (@when false "small"))))))
+			(@export sum label)`,
+	})
+
+	built, err := BuildScript(filepath.Join(dir, "main.toy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: the artifact doesn't need the sources anymore
+	if err := os.RemoveAll(filepath.Join(dir, "lib")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "main.toy")); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := LoadScript(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(script.Modules) != 2 || len(script.code) != 2 {
+		t.Fatalf("got %d modules with %d protos, want 2", len(script.Modules), len(script.code))
+	}
+
+	// NOTE: the decoded code is exactly what compiling the decoded syntax trees gives
+	for _, program := range script.Modules {
+		if !sameProto(script.code[program], Compile(program)) {
+			t.Errorf("the code of %v didn't survive the round trip", program.Span)
+		}
+	}
+
+	want := `(@list 6.5 "big" 3 "boom")`
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		e, _ := NewEngine(engine)
+		script.Preload(e)
+
+		v, err := e.Run(context.Background(), built, script.Program)
+		if err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if got := FormatValue(v); got != want {
+			t.Errorf("%s: got %s, want %s", engine, got, want)
+		}
+	}
+
+	// NOTE: the VM runs the loaded code, not the syntax tree
+	vm := NewVM(map[string]inode{})
+	script.Preload(vm)
+	if vm.compile(script.Program) != script.code[script.Program] {
+		t.Error("expected the VM to run the code of the artifact")
+	}
+}
+
+func TestArtifactVersion(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.toy": `(+ 1 2)`})
+
+	built, err := BuildScript(filepath.Join(dir, "main.toy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(built)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: swap in the header of an older build
+	rest, _ := bytes.CutPrefix(data[len(ARTIFACT_MAGIC):], binary.AppendUvarint(nil, ARTIFACT_VERSION))
+	old := append([]byte(ARTIFACT_MAGIC), binary.AppendUvarint(nil, ARTIFACT_VERSION-1)...)
+	if err := os.WriteFile(built, append(old, rest...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadScript(built)
+	if err == nil {
+		t.Fatal("expected the artifact to be rejected")
+	}
+	if want := "unsupported artifact version 4, expected 5"; !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("got %q, want it to end with %q", err, want)
+	}
+
+	_, err = readArtifact(append([]byte(ARTIFACT_MAGIC), binary.AppendUvarint(nil, ARTIFACT_VERSION)...))
+	if err == nil {
+		t.Error("expected a truncated artifact to be rejected")
+	}
+}
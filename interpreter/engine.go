@@ -0,0 +1,46 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"toyscript/ast"
+)
+
+type (
+	// Engine executes parsed programs, either by walking the AST or on the VM
+	Engine interface {
+		Preload(modules map[string]*ast.ProgramStatement)
+		Define(name string, v any)
+		Exec(filename string, p *ast.ProgramStatement) error
+		Run(ctx context.Context, filename string, p *ast.ProgramStatement) (any, error)
+	}
+)
+
+const (
+	ENGINE_TREE = "tree"
+	ENGINE_VM   = "vm"
+)
+
+// NewEngine returns a fresh engine by its name, tree or vm
+func NewEngine(name string) (Engine, error) {
+	switch name {
+	case ENGINE_TREE:
+		return NewInterpreter(map[string]inode{}), nil
+	case ENGINE_VM:
+		return NewVM(map[string]inode{}), nil
+	}
+
+	return nil, fmt.Errorf("unknown engine %s, expected tree or vm", name)
+}
+
+// DescribeError includes the toy-script traceback for runtime errors
+func DescribeError(err error) string {
+	var tErr *Error
+	if errors.As(err, &tErr) {
+		return tErr.Traceback()
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,813 @@
+package interpreter
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"toyscript/ast"
+)
+
+type (
+	inode = any
+
+	// frame is a scope and the visitor evaluating nodes in it,
+	// it's shared by the go routines of @async
+	frame struct {
+		mu     sync.RWMutex
+		vars   map[string]inode
+		parent *frame
+		interp *Interpreter
+		// ctx is the ctx of the evaluation running in the frame
+		ctx context.Context
+	}
+
+	// Interpreter evaluates the AST, every frame visits the nodes run in it
+	Interpreter struct {
+		// builtins is the root scope, the parent of the globals of the script and of every module
+		builtins *frame
+		globals  *frame
+		loader   *ModuleLoader
+		// runModule executes an imported file module and returns its exports
+		runModule func(ctx context.Context, alias string, p *ast.ProgramStatement) (*frame, error)
+	}
+
+	funcType = func(a ...any) any
+
+	// ctxFuncType is called with the ctx of the evaluation calling it,
+	// the funcs of scripts and the built-ins which wait on streams or call funcs are ctxFuncTypes
+	ctxFuncType = func(ctx context.Context, a ...any) any
+
+	// evalError is returned by the visit methods of a frame when evaluation fails,
+	// values are returned as they are so visiting doesn't allocate
+	evalError struct {
+		err error
+	}
+
+	// chainStep resolves the func of a single @chain step
+	chainStep = func() (any, error)
+)
+
+// newFrame opens a scope in p, evaluated by the interpreter of p with its ctx
+func newFrame(p *frame) *frame {
+	if p == nil {
+		return &frame{vars: map[string]inode{}}
+	}
+
+	return newContextFrame(p, p.context())
+}
+
+// newContextFrame opens a scope in p, evaluated with the ctx of another evaluation
+func newContextFrame(p *frame, ctx context.Context) *frame {
+	return &frame{
+		vars:   map[string]inode{},
+		parent: p,
+		interp: p.interp,
+		ctx:    ctx,
+	}
+}
+
+// context returns the ctx of the frame, the globals get the one of every evaluation
+func (f *frame) context() context.Context {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.ctx
+}
+
+// snapshot copies the bindings visible in f up to the built-ins into a single frame,
+// so an @async branch sees them as they were when it started
+func (f *frame) snapshot() *frame {
+	chain := []*frame{}
+	for p := f; p != nil && p != f.interp.builtins; p = p.parent {
+		chain = append(chain, p)
+	}
+
+	s := newContextFrame(f.interp.builtins, f.context())
+	// NOTE: the inner bindings shadow the outer ones
+	for _, p := range slices.Backward(chain) {
+		p.mu.RLock()
+		maps.Copy(s.vars, p.vars)
+		p.mu.RUnlock()
+	}
+
+	return s
+}
+
+func (f *frame) set(k string, v inode) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.vars[k] = v
+}
+
+func (f *frame) get(k string) (inode, bool) {
+	f.mu.RLock()
+	n, ok := f.vars[k]
+	f.mu.RUnlock()
+	if ok {
+		return n, true
+	}
+
+	if f.parent == nil {
+		return nil, false
+	}
+
+	return f.parent.get(k)
+}
+
+func NewInterpreter(globals map[string]inode) *Interpreter {
+	builtins := newFrame(nil)
+	injectBuiltins(builtins)
+
+	i := &Interpreter{
+		builtins: builtins,
+		loader:   NewModuleLoader(),
+	}
+	builtins.interp = i
+	i.globals = newContextFrame(builtins, context.Background())
+	for k, v := range globals {
+		i.globals.set(k, v)
+	}
+
+	i.runModule = func(ctx context.Context, alias string, p *ast.ProgramStatement) (*frame, error) {
+		// NOTE: every module has its own globals, it only shares the built-ins
+		return i.execModule(alias, p, newContextFrame(i.builtins, ctx))
+	}
+
+	return i
+}
+
+// Preload registers already parsed file modules by their canonical path
+func (i *Interpreter) Preload(modules map[string]*ast.ProgramStatement) {
+	for path, program := range modules {
+		i.loader.sources[path] = program
+	}
+}
+
+// Define binds a global visible to every script run afterwards,
+// go funcs are called like toy-script funcs
+func (i *Interpreter) Define(name string, v any) {
+	i.globals.set(name, v)
+}
+
+// Exec executes the script at filename, its imports are resolved relative to it
+func (i *Interpreter) Exec(filename string, p *ast.ProgramStatement) error {
+	_, err := i.Run(context.Background(), filename, p)
+	return err
+}
+
+// Run executes the program until it finishes or ctx is done,
+// imports are resolved relative to filename unless it is empty
+func (i *Interpreter) Run(ctx context.Context, filename string, p *ast.ProgramStatement) (result any, err error) {
+	if filename == "" {
+		return i.EvalContext(ctx, p)
+	}
+
+	err = i.loader.Enter(filename, func() error {
+		result, err = i.EvalContext(ctx, p)
+		return err
+	})
+	return result, err
+}
+
+// EvalContext is Eval which stops at the next func call, or while waiting on a stream,
+// once ctx is done.
+// NOTE: the @async and @map go routines still running after it returns keep ctx,
+// funcs get the ctx of the evaluation calling them
+func (i *Interpreter) EvalContext(ctx context.Context, p *ast.ProgramStatement) (result any, err error) {
+	i.globals.mu.Lock()
+	i.globals.ctx = ctx
+	i.globals.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, newError("%v", r)
+		}
+	}()
+
+	return i.execNode(p, i.globals)
+}
+
+// Eval executes the program in the global scope and returns the value
+// of its last statement, the globals are kept between calls
+func (i *Interpreter) Eval(p *ast.ProgramStatement) (any, error) {
+	return i.EvalContext(context.Background(), p)
+}
+
+// interrupted returns the error of ctx once the host cancelled the script
+func interrupted(ctx context.Context) *Error {
+	if err := ctx.Err(); err != nil {
+		return &Error{Message: err.Error(), cause: err}
+	}
+
+	return nil
+}
+
+func (i *Interpreter) execNode(n ast.Node, f *frame) (any, error) {
+	r := n.Accept(f)
+	if e, ok := r.(evalError); ok {
+		return nil, e.err
+	}
+
+	return r, nil
+}
+
+// evalReturn is the result of a visit method
+func evalReturn(v any, err error) any {
+	if err != nil {
+		return evalError{err}
+	}
+
+	return v
+}
+
+func (f *frame) VisitString(n *ast.StringLiteral) any {
+	return n.Value
+}
+
+func (f *frame) VisitNumber(n *ast.NumberLiteral) any {
+	return n.Value
+}
+
+func (f *frame) VisitBoolean(n *ast.BooleanLiteral) any {
+	return n.Value
+}
+
+func (f *frame) VisitList(n *ast.ListLiteral) any {
+	return evalReturn(f.interp.evalList(n, f))
+}
+
+func (f *frame) VisitHash(n *ast.HashLiteral) any {
+	return evalReturn(f.interp.evalHash(n, f))
+}
+
+func (f *frame) VisitStream(n *ast.StreamLiteral) any {
+	return evalReturn(f.interp.evalStream(n, f))
+}
+
+func (f *frame) VisitFunc(n *ast.FuncLiteral) any {
+	return f.interp.defineFunc(n, f)
+}
+
+func (f *frame) VisitProgram(n *ast.ProgramStatement) any {
+	var lastValue any
+	for _, s := range n.Body {
+		v, err := f.interp.execNode(s, f)
+		if err != nil {
+			return evalError{err}
+		}
+		lastValue = v
+	}
+
+	return lastValue
+}
+
+func (f *frame) VisitVar(n *ast.VarStatement) any {
+	return evalReturn(nil, f.interp.execVar(n, f))
+}
+
+func (f *frame) VisitImport(n *ast.ImportStatement) any {
+	return evalReturn(nil, f.interp.execImport(f.context(), n, f))
+}
+
+func (f *frame) VisitExport(n *ast.ExportStatement) any {
+	// NOTE: we don't care about the exports of the currently executing program
+	return nil
+}
+
+func (f *frame) VisitRef(n *ast.ReferenceExpression) any {
+	return evalReturn(f.interp.resolveRef(n, f))
+}
+
+func (f *frame) VisitCall(n *ast.CallExpression) any {
+	return evalReturn(f.interp.execFuncCall(n, f))
+}
+
+func (f *frame) VisitMatch(n *ast.MatchExpression) any {
+	return evalReturn(f.interp.evalMatch(n, f))
+}
+
+func (f *frame) VisitMalformed(n *ast.MalformedExpression) any {
+	return evalError{newError("failed to execute malformed expression: %s", n.Error)}
+}
+
+func (f *frame) VisitSeq(n *ast.SeqExpression) any {
+	return evalReturn(f.interp.execSeq(n, f))
+}
+
+func (f *frame) VisitChain(n *ast.ChainExpression) any {
+	return f.interp.defineChain(n, f)
+}
+
+func (f *frame) VisitAsync(n *ast.AsyncExpression) any {
+	return f.interp.execAsync(n, f)
+}
+
+func (f *frame) VisitLogical(n *ast.LogicalExpression) any {
+	return evalReturn(f.interp.evalLogical(n, f))
+}
+
+func (f *frame) VisitTry(n *ast.TryExpression) any {
+	return evalReturn(f.interp.evalTry(n, f))
+}
+
+func (f *frame) VisitSelect(n *ast.SelectExpression) any {
+	return evalReturn(f.interp.evalSelect(n, f))
+}
+
+func (i *Interpreter) evalList(list *ast.ListLiteral, f *frame) (any, error) {
+	results := []any{}
+	for _, el := range list.Elements {
+		v, err := i.execNode(el, f)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, v)
+	}
+
+	return results, nil
+}
+
+func (i *Interpreter) evalHash(hash *ast.HashLiteral, f *frame) (any, error) {
+	results := map[string]any{}
+	for _, el := range hash.Elements {
+		v, err := i.execNode(el.Value, f)
+		if err != nil {
+			return nil, err
+		}
+
+		results[el.Key] = v
+	}
+
+	return results, nil
+}
+
+func (i *Interpreter) evalStream(stream *ast.StreamLiteral, f *frame) (any, error) {
+	var capacity any
+	if stream.Capacity != nil {
+		v, err := i.execNode(stream.Capacity, f)
+		if err != nil {
+			return nil, err
+		}
+		capacity = v
+	}
+
+	values := []any{}
+	for _, el := range stream.Values {
+		v, err := i.execNode(el, f)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	size := len(values)
+	if stream.Capacity != nil {
+		n, err := streamCapacity(capacity, size)
+		if err != nil {
+			return nil, err
+		}
+		size = n
+	}
+
+	return newStream(size, values), nil
+}
+
+func (i *Interpreter) execModule(alias string, p *ast.ProgramStatement, f *frame) (*frame, error) {
+	var exports *frame
+	for _, s := range p.Body {
+		switch s := s.(type) {
+		case *ast.ExportStatement:
+			e, err := i.execExport(s, f)
+			if err != nil {
+				return nil, err
+			}
+			exports = e
+		default:
+			_, err := i.execNode(s, f)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if exports == nil {
+		return nil, newError("module has not exports %s", alias)
+	}
+
+	return exports, nil
+}
+
+func (i *Interpreter) execVar(v *ast.VarStatement, f *frame) error {
+	if f == nil {
+		return newError("unexpected nil stackframe")
+	}
+
+	// NOTE: bindings are sequential, each one can use the ones before it
+	for _, b := range v.Vars {
+		resolvedValue, err := i.execNode(b.Value, f)
+		if err != nil {
+			return err
+		}
+
+		f.set(b.Name, resolvedValue)
+	}
+
+	return nil
+}
+
+// execImport binds the imported modules in f, the globals of the importing module,
+// file modules run with the ctx of the evaluation importing them
+func (i *Interpreter) execImport(ctx context.Context, imprt *ast.ImportStatement, f *frame) error {
+	for alias, path := range imprt.Imports {
+		if module, ok := nativeModule(path); ok {
+			f.set(alias, module)
+			continue
+		}
+
+		canonical, err := i.loader.Resolve(path)
+		if err != nil {
+			return err
+		}
+
+		module, err := i.loader.load(canonical, func(program *ast.ProgramStatement) (*frame, error) {
+			return i.runModule(ctx, alias, program)
+		})
+		if err != nil {
+			return err
+		}
+		f.set(alias, module)
+	}
+
+	return nil
+}
+
+func (i *Interpreter) execExport(export *ast.ExportStatement, f *frame) (*frame, error) {
+	output := newFrame(nil)
+	for _, e := range export.Exports {
+		expRef := e.(*ast.ReferenceExpression)
+		expVal, err := i.execNode(e, f)
+		if err != nil {
+			return nil, err
+		}
+		output.set(expRef.RefName, expVal)
+	}
+
+	return output, nil
+}
+
+func (i *Interpreter) defineFunc(fn *ast.FuncLiteral, f *frame) ctxFuncType {
+	return func(ctx context.Context, a ...any) any {
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+
+		innerFrame := newContextFrame(f, ctx)
+		for idx, paramName := range fn.Params {
+			if len(a) > idx {
+				innerFrame.set(paramName, a[idx])
+			}
+		}
+
+		var lastResult any
+		for _, funcExpr := range fn.Body {
+			v, err := i.execNode(funcExpr, innerFrame)
+			if err != nil {
+				// NOTE: the error is raised again at the call site
+				return asToyError(err).withFrame("@func", fn.Span.Start)
+			}
+			lastResult = v
+		}
+		return lastResult
+	}
+}
+
+func (i *Interpreter) execFuncCall(c *ast.CallExpression, f *frame) (any, error) {
+	callee, err := i.execNode(c.Callee, f)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []inode{}
+	for _, arg := range c.Args {
+		v, err := i.execNode(arg, f)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+
+	if !isFunc(callee) {
+		return nil, newError("failed to cast function in call expression: %s is a %s", c.Callee, describeType(callee))
+	}
+
+	v, err := callFunc(f.context(), callee, args)
+	if err != nil {
+		return nil, asToyError(err).withFrame(ast.CalleeName(c.Callee), c.Span.Start)
+	}
+
+	return v, nil
+}
+
+func (i *Interpreter) resolveRef(r *ast.ReferenceExpression, f *frame) (any, error) {
+	var (
+		v  inode
+		ok bool
+	)
+
+	switch r.RefType {
+	case ast.REF_TYPE_BUILTIN:
+		v, ok = i.builtins.get(r.RefName)
+	case ast.REF_TYPE_DECLARED:
+		v, ok = f.get(r.RefName)
+	case ast.REF_TYPE_IMPORTED:
+		return i.resolveImported(r.RefName, f)
+	}
+
+	if !ok {
+		return nil, newError("failed to resolve ref %s (%s)", r.RefName, r.RefType)
+	}
+	vN, ok := v.(ast.Node)
+	if ok {
+		return i.execNode(vN, f)
+	}
+
+	return v, nil
+}
+
+// resolveImported looks up a module.member ref in the modules imported into the scope of f
+func (i *Interpreter) resolveImported(name string, f *frame) (any, error) {
+	impRef := strings.Split(name, ".")
+	if len(impRef) != 2 {
+		return nil, newError("malformed imported ref: %s", name)
+	}
+
+	v, ok := f.get(impRef[0])
+	if ok {
+		module, isModule := v.(*frame)
+		if !isModule {
+			return nil, newError("%s is not an imported module", impRef[0])
+		}
+
+		v, ok = module.get(impRef[1])
+		if ok {
+			return v, nil
+		}
+	}
+
+	return nil, newError("failed to resolve ref %s (%s)", name, ast.REF_TYPE_IMPORTED)
+}
+
+func (i *Interpreter) execSeq(s *ast.SeqExpression, f *frame) (any, error) {
+	var lastValue any
+	for _, e := range s.Expressions {
+		v, err := i.execNode(e, f)
+		if err != nil {
+			return nil, err
+		}
+		lastValue = v
+	}
+
+	return lastValue, nil
+}
+
+func (i *Interpreter) defineChain(c *ast.ChainExpression, f *frame) ctxFuncType {
+	steps := []chainStep{}
+	for _, e := range c.Expressions {
+		steps = append(steps, func() (any, error) {
+			switch e := e.(type) {
+			case *ast.FuncLiteral:
+				return i.defineFunc(e, f), nil
+			case *ast.ReferenceExpression:
+				refVal, err := i.resolveRef(e, f)
+				if err != nil {
+					return nil, err
+				}
+
+				if !isFunc(refVal) {
+					return nil, newError("expected func in chain: %s", e)
+				}
+				return refVal, nil
+			}
+
+			return nil, newError("unexpected expression in chain: %s ", e)
+		})
+	}
+
+	return newChain(steps)
+}
+
+// newChain pipes the funcs of the steps, which are resolved on every call
+func newChain(steps []chainStep) ctxFuncType {
+	return func(ctx context.Context, a ...any) any {
+		args := a
+		var lastResult any
+		for _, step := range steps {
+			fn, err := step()
+			if err != nil {
+				return asToyError(err)
+			}
+
+			// NOTE: the first func receives all args,
+			// every other one the result of the previous func
+			v, err := callFunc(ctx, fn, args)
+			if err != nil {
+				return asToyError(err)
+			}
+			lastResult = v
+			args = []any{lastResult}
+		}
+
+		return lastResult
+	}
+}
+
+func (i *Interpreter) evalMatch(m *ast.MatchExpression, f *frame) (any, error) {
+	mf := newFrame(f)
+
+	expected, err := i.execNode(m.Cond, f)
+	if err != nil {
+		return nil, err
+	}
+
+	mf.set("value", expected)
+
+	// NOTE: the first matching case wins
+	for _, c := range m.Cases {
+		cr, err := i.execNode(c.When, mf)
+		if err != nil {
+			return nil, err
+		}
+
+		// a matcher expression producing true matches the value
+		_, isLiteral := c.When.(*ast.BooleanLiteral)
+		if res, ok := cr.(bool); !isLiteral && ok && res {
+			return i.execNode(c.Then, mf)
+		}
+
+		eq, err := deepEqual(cr, expected)
+		if err != nil {
+			return nil, newError("@match: %s", err.Error())
+		}
+		if eq {
+			return i.execNode(c.Then, mf)
+		}
+	}
+
+	return nil, nil
+}
+
+func (i *Interpreter) evalSelect(s *ast.SelectExpression, f *frame) (any, error) {
+	streams := []any{}
+	for _, c := range s.Cases {
+		v, err := i.execNode(c.Stream, f)
+		if err != nil {
+			return nil, err
+		}
+
+		streams = append(streams, v)
+	}
+
+	var timeout any
+	if s.Timeout != nil {
+		v, err := i.execNode(s.Timeout.After, f)
+		if err != nil {
+			return nil, err
+		}
+		timeout = v
+	}
+
+	chosen, value, err := selectStream(f.context(), streams, s.Default != nil, timeout, s.Timeout != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sf := newFrame(f)
+	switch chosen {
+	case SELECT_CLOSED:
+		return nil, nil
+	case SELECT_DEFAULT:
+		return i.execNode(s.Default, sf)
+	case SELECT_TIMEOUT:
+		return i.execNode(s.Timeout.Then, sf)
+	}
+
+	sf.set("value", value)
+	return i.execNode(s.Cases[chosen].Then, sf)
+}
+
+func (i *Interpreter) execAsync(a *ast.AsyncExpression, f *frame) any {
+	thunks := []func() (any, error){}
+	bindings := f.snapshot()
+	for _, e := range a.Expressions {
+		// NOTE: the bindings of a branch stay in its frame
+		bf := newFrame(bindings)
+		thunks = append(thunks, func() (any, error) {
+			return i.execNode(e, bf)
+		})
+	}
+
+	return spawnAsync(f.context(), thunks, a.Ordered)
+}
+
+// spawnAsync evaluates every thunk in its own go routine and sends the results
+// on the returned stream as they complete, or in the order of the thunks when ordered.
+// The stream is closed once all of them are done, or once ctx is done
+func spawnAsync(ctx context.Context, thunks []func() (any, error), ordered bool) chan any {
+	ch := make(chan any)
+	results := make([]chan any, len(thunks))
+	wg := sync.WaitGroup{}
+
+	for idx, t := range thunks {
+		out := ch
+		if ordered {
+			// NOTE: a result waits in its own slot until the earlier ones are sent
+			results[idx] = make(chan any, 1)
+			out = results[idx]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// NOTE: nobody reads the results of a cancelled script
+			select {
+			case out <- runAsync(t):
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ch)
+		if ordered {
+			for _, r := range results {
+				v, _, err := receiveStream(ctx, r)
+				if err != nil {
+					break
+				}
+				if sent, _ := sendStream(ctx, "@async", ch, v, -1); !sent {
+					break
+				}
+			}
+		}
+		wg.Wait()
+	}()
+
+	return ch
+}
+
+// runAsync evaluates a single @async expression, its error or panic
+// is returned as the value, to be raised by whoever reads it from the stream
+func runAsync(t func() (any, error)) (result any) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("%v", r)
+		}
+	}()
+
+	v, err := t()
+	if err != nil {
+		return asToyError(err)
+	}
+
+	return v
+}
+
+func (i *Interpreter) evalLogical(l *ast.LogicalExpression, f *frame) (any, error) {
+	// NOTE: (@and) is true and (@or) is false
+	stopAt := l.Operator == "@or"
+	for _, o := range l.Operands {
+		ov, err := i.execNode(o, f)
+		if err != nil {
+			return nil, err
+		}
+
+		v, ok := ov.(bool)
+		if !ok {
+			return nil, newError("%s: expected a boolean operand, got %v", l.Operator, o)
+		}
+
+		if v == stopAt {
+			return v, nil
+		}
+	}
+
+	return !stopAt, nil
+}
+
+func (i *Interpreter) evalTry(t *ast.TryExpression, f *frame) (any, error) {
+	v, err := i.execNode(t.Body, f)
+	if err == nil {
+		return v, nil
+	}
+
+	cf := newFrame(f)
+	cf.set(t.ErrName, caught(err))
+
+	return i.execNode(t.Handler, cf)
+}
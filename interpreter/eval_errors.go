@@ -0,0 +1,156 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"toyscript/lexer"
+)
+
+type (
+	// Error is the error value of toy-script.
+	// Built-ins and functions raise an error by returning a *Error,
+	// it then unwinds the evaluation until it reaches a @try or the host.
+	Error struct {
+		Message string
+		Trace   []TraceFrame
+		// cause is the go error the toy-script error was raised from
+		cause error
+	}
+
+	// TraceFrame is a single toy-script frame the error unwound through
+	TraceFrame struct {
+		Function string
+		Pos      lexer.Position
+	}
+
+	// CaughtError is an error bound by a @catch, unlike a *Error it's a plain value
+	// which can be stored, passed to funcs and returned without being raised again
+	CaughtError struct {
+		Err *Error
+	}
+)
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the go error raised by a native func or the context, if any
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// withFrame records that the error unwound through fn at the given position,
+// on a copy so an error raised more than once doesn't gather stale frames
+func (e *Error) withFrame(fn string, pos lexer.Position) *Error {
+	c := *e
+	c.Trace = append(slices.Clip(e.Trace), TraceFrame{fn, pos})
+	return &c
+}
+
+// Traceback renders the error with the toy-script frames
+// it unwound through, the innermost frame first
+func (e *Error) Traceback() string {
+	str := strings.Builder{}
+	str.WriteString("error: " + e.Message)
+
+	for _, tf := range e.Trace {
+		str.WriteString(fmt.Sprintf("\n  at %s (line %d, column %d)", tf.Function, tf.Pos.Line, tf.Pos.Column))
+	}
+
+	return str.String()
+}
+
+// asToyError converts any go error into a toy-script error value
+func asToyError(err error) *Error {
+	var tErr *Error
+	if errors.As(err, &tErr) {
+		return tErr
+	}
+
+	return &Error{Message: err.Error(), cause: err}
+}
+
+// caught binds a raised error as the value of a @catch
+func caught(err error) CaughtError {
+	return CaughtError{asToyError(err)}
+}
+
+// Native adapts a go func returning an error to a toy-script func,
+// the error is raised in the script and can be caught by a @try
+func Native(fn func(a ...any) (any, error)) funcType {
+	return func(a ...any) any {
+		v, err := fn(a...)
+		if err != nil {
+			return asToyError(err)
+		}
+		return v
+	}
+}
+
+// expectArgs is used by built-ins to validate the number of received arguments
+func expectArgs(name string, a []any, n int) *Error {
+	if len(a) < n {
+		return newError("%s: expected at least %d arguments, got %d", name, n, len(a))
+	}
+
+	return nil
+}
+
+// isFunc reports whether v can be called, go funcs don't get the ctx of the caller
+func isFunc(v any) bool {
+	switch v.(type) {
+	case funcType, ctxFuncType:
+		return true
+	}
+
+	return false
+}
+
+// callFunc invokes a toy-script function with the ctx of the caller and converts
+// a returned error value back into a go error. Panics in go built-ins are
+// recovered so they don't bring down the host process.
+func callFunc(ctx context.Context, fn any, args []any) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, newError("%v", r)
+		}
+	}()
+
+	switch fn := fn.(type) {
+	case ctxFuncType:
+		result = fn(ctx, args...)
+	case funcType:
+		result = fn(args...)
+	}
+	if tErr, ok := result.(*Error); ok {
+		return nil, tErr
+	}
+
+	return result, nil
+}
+
+func toyRaise(a ...any) any {
+	if err := expectArgs("@error", a, 1); err != nil {
+		return err
+	}
+
+	// NOTE: a caught error is raised again, with a new trace
+	if c, ok := a[0].(CaughtError); ok {
+		return &Error{Message: c.Err.Message, cause: c.Err.cause}
+	}
+
+	msg, ok := a[0].(string)
+	if !ok {
+		return newError("@error: expected a string message, got %s", describeType(a[0]))
+	}
+
+	return &Error{Message: msg}
+}
@@ -0,0 +1,731 @@
+package interpreter
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"toyscript/ast"
+)
+
+// NOTE: @async branches share the lists and hashes they capture, @set locks the one
+// it writes and the built-ins reading one lock it for reading.
+// A single lock is held at a time and funcs are never called with it held,
+// they may @set the same container
+var containerLocks [64]sync.RWMutex
+
+// lockOf returns the lock of a list or hash, picked by the address of its elements
+// so unrelated containers rarely wait on each other
+func lockOf(container any) *sync.RWMutex {
+	h := uint64(reflect.ValueOf(container).Pointer()) * 0x9e3779b97f4a7c15
+	return &containerLocks[h>>58]
+}
+
+// snapshotList copies a list so it can be visited without the lock
+func snapshotList(l []any) []any {
+	mu := lockOf(l)
+	mu.RLock()
+	defer mu.RUnlock()
+	return slices.Clone(l)
+}
+
+// snapshotHash copies a hash so it can be visited without the lock
+func snapshotHash(h map[string]any) map[string]any {
+	mu := lockOf(h)
+	mu.RLock()
+	defer mu.RUnlock()
+	return maps.Clone(h)
+}
+
+// snapshotValue deep copies the lists and hashes of v, locking one at a time
+func snapshotValue(v any) any {
+	switch val := v.(type) {
+	case []any:
+		l := snapshotList(val)
+		for idx, el := range l {
+			l[idx] = snapshotValue(el)
+		}
+		return l
+	case map[string]any:
+		h := snapshotHash(val)
+		for k, el := range h {
+			h[k] = snapshotValue(el)
+		}
+		return h
+	}
+
+	return v
+}
+
+// Builtins returns the names of the built-in funcs, sorted
+func Builtins() []string {
+	f := newFrame(nil)
+	injectBuiltins(f)
+	return slices.Sorted(maps.Keys(f.vars))
+}
+
+func injectBuiltins(f *frame) {
+	f.set("@map", toyMap)
+	f.set("@filter", toyFilter)
+	f.set("@get", toyGet)
+	f.set("@set", toySet)
+	f.set("@has", toyHas)
+	f.set("@len", toyLen)
+	f.set("@close", toyClose)
+	f.set("@await", toyAwait)
+	f.set("@collect", toyCollect)
+	f.set("@push", toyPush)
+	f.set("@try-push", toyTryPush)
+	f.set("=", toyEqual)
+	f.set("!=", toyNotEqual)
+	f.set("<", toyLess)
+	f.set("<=", toyLessEqual)
+	f.set(">", toyMore)
+	f.set(">=", toyMoreEqual)
+	f.set("!", toyNot)
+	f.set("+", toyAdd)
+	f.set("-", toySub)
+	f.set("*", toyMul)
+	f.set("/", toyDiv)
+	f.set("%", toyMod)
+
+	f.set("@error", toyRaise)
+
+	// aliases
+	f.set("@pull", toyGet)
+	f.set("@not", toyNot)
+}
+
+func toyMap(ctx context.Context, a ...any) any {
+	if err := expectArgs("@map", a, 2); err != nil {
+		return err
+	}
+
+	fn := a[0]
+	if !isFunc(fn) {
+		return newError("@map: expected a function, got %s", describeType(a[0]))
+	}
+
+	if _, isStream := a[1].(chan any); !isStream && len(a) > 2 {
+		return newError("@map: concurrency is only supported for streams")
+	}
+
+	switch obj := a[1].(type) {
+	case []any:
+		results := []any{}
+		for _, el := range snapshotList(obj) {
+			r, err := callFunc(ctx, fn, []any{el})
+			if err != nil {
+				return err
+			}
+			results = append(results, r)
+		}
+
+		return results
+	case map[string]any:
+		obj = snapshotHash(obj)
+		results := map[string]any{}
+		// NOTE: go maps are unordered, visit the keys in a stable order
+		for _, k := range slices.Sorted(maps.Keys(obj)) {
+			r, err := callFunc(ctx, fn, []any{obj[k]})
+			if err != nil {
+				return err
+			}
+			results[k] = r
+		}
+
+		return results
+	case chan any:
+		workers, err := streamConcurrency("@map", a)
+		if err != nil {
+			return err
+		}
+
+		// NOTE: the values are mapped in the background, as they arrive
+		return pipeStream(ctx, obj, workers, func(el any) (any, bool, error) {
+			r, err := callFunc(ctx, fn, []any{el})
+			return r, true, err
+		})
+	}
+
+	return newError("@map: unable to map over %s", describeType(a[1]))
+}
+
+func toyFilter(ctx context.Context, a ...any) any {
+	if err := expectArgs("@filter", a, 2); err != nil {
+		return err
+	}
+
+	fn := a[0]
+	if !isFunc(fn) {
+		return newError("@filter: expected a function, got %s", describeType(a[0]))
+	}
+
+	if _, isStream := a[1].(chan any); !isStream && len(a) > 2 {
+		return newError("@filter: concurrency is only supported for streams")
+	}
+
+	keep := func(el any) (bool, error) {
+		r, err := callFunc(ctx, fn, []any{el})
+		if err != nil {
+			return false, err
+		}
+
+		b, ok := r.(bool)
+		if !ok {
+			return false, newError("@filter: expected the function to return a boolean, got %s", describeType(r))
+		}
+		return b, nil
+	}
+
+	switch obj := a[1].(type) {
+	case []any:
+		results := []any{}
+		for _, el := range snapshotList(obj) {
+			ok, err := keep(el)
+			if err != nil {
+				return err
+			}
+			if ok {
+				results = append(results, el)
+			}
+		}
+
+		return results
+	case map[string]any:
+		obj = snapshotHash(obj)
+		results := map[string]any{}
+		// NOTE: go maps are unordered, visit the keys in a stable order
+		for _, k := range slices.Sorted(maps.Keys(obj)) {
+			ok, err := keep(obj[k])
+			if err != nil {
+				return err
+			}
+			if ok {
+				results[k] = obj[k]
+			}
+		}
+
+		return results
+	case chan any:
+		workers, err := streamConcurrency("@filter", a)
+		if err != nil {
+			return err
+		}
+
+		return pipeStream(ctx, obj, workers, func(el any) (any, bool, error) {
+			ok, err := keep(el)
+			return el, ok, err
+		})
+	}
+
+	return newError("@filter: unable to filter %s", describeType(a[1]))
+}
+
+func toyGet(ctx context.Context, a ...any) any {
+	if err := expectArgs("@get", a, 1); err != nil {
+		return err
+	}
+
+	switch obj := a[0].(type) {
+	case []any:
+		if err := expectArgs("@get", a, 2); err != nil {
+			return err
+		}
+
+		idx, ok := toIndex(a[1])
+		if !ok {
+			return newError("@get: list index must be a whole number, got %v", a[1])
+		}
+
+		mu := lockOf(obj)
+		mu.RLock()
+		defer mu.RUnlock()
+		if idx < 0 || idx >= len(obj) {
+			return newError("@get: index %d out of range for list of length %d", idx, len(obj))
+		}
+
+		return obj[idx]
+	case map[string]any:
+		if err := expectArgs("@get", a, 2); err != nil {
+			return err
+		}
+
+		key, ok := a[1].(string)
+		if !ok {
+			return newError("@get: hash key must be a string, got %s", describeType(a[1]))
+		}
+
+		mu := lockOf(obj)
+		mu.RLock()
+		defer mu.RUnlock()
+		return obj[key]
+	case CaughtError:
+		// NOTE: caught errors expose their message
+		if len(a) > 1 && a[1] == "message" {
+			return obj.Err.Message
+		}
+
+		return newError("@get: errors only have a \"message\"")
+	case chan any:
+		v, _, err := receiveStream(ctx, obj)
+		if err != nil {
+			return err
+		}
+		return v
+	}
+
+	return newError("@get: unsupported collection %s", describeType(a[0]))
+}
+
+func toyHas(ctx context.Context, a ...any) any {
+	if err := expectArgs("@has", a, 2); err != nil {
+		return err
+	}
+
+	query := a[1]
+	switch obj := a[0].(type) {
+	case []any:
+		for _, el := range snapshotList(obj) {
+			eq, err := deepEqual(el, query)
+			if err != nil {
+				return newError("@has: %s", err.Error())
+			}
+			if eq {
+				return true
+			}
+		}
+
+		return false
+	case map[string]any:
+		key, ok := query.(string)
+		if !ok {
+			return newError("@has: hash key must be a string, got %s", describeType(query))
+		}
+
+		mu := lockOf(obj)
+		mu.RLock()
+		defer mu.RUnlock()
+		_, ok = obj[key]
+		return ok
+	case chan any:
+		for {
+			el, ok, waitErr := receiveStream(ctx, obj)
+			if waitErr != nil {
+				return waitErr
+			}
+			if !ok {
+				return false
+			}
+
+			eq, err := deepEqual(el, query)
+			if err != nil {
+				return newError("@has: %s", err.Error())
+			}
+			if eq {
+				return true
+			}
+		}
+	}
+
+	return newError("@has: unsupported collection %s", describeType(a[0]))
+}
+
+func toySet(ctx context.Context, a ...any) any {
+	if err := expectArgs("@set", a, 2); err != nil {
+		return err
+	}
+
+	switch obj := a[0].(type) {
+	case []any:
+		if err := expectArgs("@set", a, 3); err != nil {
+			return err
+		}
+
+		idx, isIndex := toIndex(a[1])
+		if !isIndex {
+			return newError("@set: list index must be a whole number, got %v", a[1])
+		}
+
+		mu := lockOf(obj)
+		mu.Lock()
+		defer mu.Unlock()
+		if idx < 0 || idx >= len(obj) {
+			return newError("@set: index %d out of range for list of length %d", idx, len(obj))
+		}
+
+		obj[idx] = a[2]
+		return nil
+	case map[string]any:
+		if err := expectArgs("@set", a, 3); err != nil {
+			return err
+		}
+
+		key, ok := a[1].(string)
+		if !ok {
+			return newError("@set: hash key must be a string, got %s", describeType(a[1]))
+		}
+
+		mu := lockOf(obj)
+		mu.Lock()
+		defer mu.Unlock()
+		obj[key] = a[2]
+		return nil
+	case chan any:
+		// NOTE: setting on a stream pushes the value
+		return toyPush(ctx, a...)
+	}
+
+	return newError("@set: unsupported collection %s", describeType(a[0]))
+}
+
+func toyLen(a ...any) any {
+	if err := expectArgs("@len", a, 1); err != nil {
+		return err
+	}
+
+	switch obj := a[0].(type) {
+	case string:
+		return len(obj)
+	case []any:
+		return len(obj)
+	case map[string]any:
+		mu := lockOf(obj)
+		mu.RLock()
+		defer mu.RUnlock()
+		return len(obj)
+	case chan any:
+		return len(obj)
+	}
+
+	return newError("@len: unsupported collection %s", describeType(a[0]))
+}
+
+func toyEqual(a ...any) any {
+	if err := expectArgs("=", a, 1); err != nil {
+		return err
+	}
+
+	last := a[0]
+	for _, ai := range a[1:] {
+		eq, err := deepEqual(last, ai)
+		if err != nil {
+			return newError("=: %s", err.Error())
+		}
+
+		if !eq {
+			return false
+		}
+	}
+
+	return true
+}
+
+func deepEqual(x, y any) (bool, error) {
+	return equalValues(snapshotValue(x), snapshotValue(y))
+}
+
+func equalValues(x, y any) (bool, error) {
+	if !isComparable(x) {
+		return false, fmt.Errorf("cannot compare %s", describeType(x))
+	}
+	if !isComparable(y) {
+		return false, fmt.Errorf("cannot compare %s", describeType(y))
+	}
+
+	if isNumber(x) && isNumber(y) {
+		return numbersEqual(x, y), nil
+	}
+
+	switch xv := x.(type) {
+	case nil:
+		return y == nil, nil
+	case string:
+		yv, ok := y.(string)
+		return ok && xv == yv, nil
+	case bool:
+		yv, ok := y.(bool)
+		return ok && xv == yv, nil
+	case []byte:
+		yv, ok := y.([]byte)
+		return ok && bytes.Equal(xv, yv), nil
+	case []any:
+		yv, ok := y.([]any)
+		if !ok || len(xv) != len(yv) {
+			return false, nil
+		}
+
+		for idx := range xv {
+			eq, err := equalValues(xv[idx], yv[idx])
+			if err != nil || !eq {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case map[string]any:
+		yv, ok := y.(map[string]any)
+		if !ok || len(xv) != len(yv) {
+			return false, nil
+		}
+
+		for key, xel := range xv {
+			yel, ok := yv[key]
+			if !ok {
+				return false, nil
+			}
+
+			eq, err := equalValues(xel, yel)
+			if err != nil || !eq {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case CaughtError:
+		yv, ok := y.(CaughtError)
+		return ok && xv.Err.Message == yv.Err.Message, nil
+	}
+
+	return false, nil
+}
+
+func isComparable(v any) bool {
+	switch v.(type) {
+	case funcType, ctxFuncType, chan any, *frame:
+		return false
+	}
+
+	return true
+}
+
+func describeType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case int, float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []byte:
+		return "bytes"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "hash"
+	case funcType, ctxFuncType:
+		return "function"
+	case chan any:
+		return "stream"
+	case *frame:
+		return "module"
+	case CaughtError, *Error:
+		return "error"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// FormatValue renders a value the way the REPL prints it
+func FormatValue(v any) string {
+	return formatValue(snapshotValue(v))
+}
+
+func formatValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "nil"
+	case int, float64:
+		return ast.FormatNumber(val)
+	case string:
+		return strconv.Quote(val)
+	case bool:
+		return strconv.FormatBool(val)
+	case []byte:
+		return strconv.Quote(string(val))
+	case []any:
+		els := []string{}
+		for _, el := range val {
+			els = append(els, formatValue(el))
+		}
+
+		return "(@list " + strings.Join(els, " ") + ")"
+	case map[string]any:
+		els := []string{}
+		for _, k := range slices.Sorted(maps.Keys(val)) {
+			els = append(els, "("+strconv.Quote(k)+" "+formatValue(val[k])+")")
+		}
+
+		return "(@hash " + strings.Join(els, " ") + ")"
+	case *Error:
+		return "<error: " + val.Message + ">"
+	case CaughtError:
+		return "<error: " + val.Err.Message + ">"
+	}
+
+	return "<" + describeType(v) + ">"
+}
+
+func toyNotEqual(a ...any) any {
+	eq := toyEqual(a...)
+	if err, isErr := eq.(*Error); isErr {
+		return newError("!%s", err.Message)
+	}
+
+	return !eq.(bool)
+}
+
+func toyNot(a ...any) any {
+	if len(a) != 1 {
+		return newError("!: expected exactly one argument, got %d", len(a))
+	}
+
+	b, ok := a[0].(bool)
+	if !ok {
+		return newError("!: expected a boolean, got %s", describeType(a[0]))
+	}
+
+	return !b
+}
+
+func toyLess(a ...any) any {
+	return compareChain("<", a, func(c int) bool { return c < 0 })
+}
+
+func toyLessEqual(a ...any) any {
+	return compareChain("<=", a, func(c int) bool { return c <= 0 })
+}
+
+func toyMore(a ...any) any {
+	return compareChain(">", a, func(c int) bool { return c > 0 })
+}
+
+func toyMoreEqual(a ...any) any {
+	return compareChain(">=", a, func(c int) bool { return c >= 0 })
+}
+
+// compareChain checks that every pair of neighbouring values satisfies ok,
+// i.e. (< 1 2 3) is true when the values are strictly increasing
+func compareChain(name string, a []any, ok func(c int) bool) any {
+	if len(a) < 2 {
+		return newError("%s: expected at least two arguments", name)
+	}
+
+	for idx := 1; idx < len(a); idx += 1 {
+		c, err := compareValues(name, a[idx-1], a[idx])
+		if err != nil {
+			return err
+		}
+
+		if !ok(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compareValues(name string, x, y any) (int, *Error) {
+	if isNumber(x) && isNumber(y) {
+		xi, xIsInt := x.(int)
+		yi, yIsInt := y.(int)
+		if xIsInt && yIsInt {
+			return cmp.Compare(xi, yi), nil
+		}
+
+		xf, _ := toFloat(x)
+		yf, _ := toFloat(y)
+		return cmp.Compare(xf, yf), nil
+	}
+
+	xs, xIsStr := x.(string)
+	ys, yIsStr := y.(string)
+	if xIsStr && yIsStr {
+		return strings.Compare(xs, ys), nil
+	}
+
+	return 0, newError("%s: cannot compare %s and %s", name, describeType(x), describeType(y))
+}
+
+func toyClose(a ...any) (result any) {
+	if err := expectArgs("@close", a, 1); err != nil {
+		return err
+	}
+
+	ch, ok := a[0].(chan any)
+	if !ok {
+		return newError("@close: expected a stream, got %s", describeType(a[0]))
+	}
+
+	// NOTE: go panics when closing a closed channel
+	defer func() {
+		if recover() != nil {
+			result = newError("@close: the stream is already closed")
+		}
+	}()
+
+	close(ch)
+	return nil
+}
+
+func toyAwait(ctx context.Context, a ...any) any {
+	if err := expectArgs("@await", a, 1); err != nil {
+		return err
+	}
+
+	ch, ok := a[0].(chan any)
+	if !ok {
+		return newError("@await: expected a stream, got %s", describeType(a[0]))
+	}
+
+	v, _, err := receiveStream(ctx, ch)
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+func toyCollect(ctx context.Context, a ...any) any {
+	if err := expectArgs("@collect", a, 1); err != nil {
+		return err
+	}
+
+	switch collection := a[0].(type) {
+	case map[string]any:
+		collection = snapshotHash(collection)
+		result := []any{}
+		for _, k := range slices.Sorted(maps.Keys(collection)) {
+			result = append(result, collection[k])
+		}
+
+		return result
+	case chan any:
+		result := []any{}
+		for {
+			el, ok, err := receiveStream(ctx, collection)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return result
+			}
+
+			// NOTE: errors sent on the stream are raised by the reader
+			if err, isErr := el.(*Error); isErr {
+				return err
+			}
+			result = append(result, el)
+		}
+	default:
+		return a
+	}
+}
@@ -0,0 +1,170 @@
+package interpreter
+
+import (
+	"math"
+)
+
+// NOTE: toy-script numbers are either an int or a float64.
+// Whenever the two are mixed the int is promoted to a float64.
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, float64:
+		return true
+	}
+
+	return false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+// toIndex accepts ints and whole floats (json.parse only produces floats)
+func toIndex(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		if n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return int(n), true
+		}
+	}
+
+	return 0, false
+}
+
+func numbersEqual(a, b any) bool {
+	ai, aIsInt := a.(int)
+	bi, bIsInt := b.(int)
+	if aIsInt && bIsInt {
+		return ai == bi
+	}
+
+	af, aOk := toFloat(a)
+	bf, bOk := toFloat(b)
+
+	return aOk && bOk && af == bf
+}
+
+func toyAdd(a ...any) any {
+	return foldNumbers("+", 0, a, func(x, y int) any {
+		return x + y
+	}, func(x, y float64) any {
+		return x + y
+	})
+}
+
+func toySub(a ...any) any {
+	if len(a) == 0 {
+		return newError("-: expected at least one argument")
+	}
+
+	if len(a) == 1 {
+		// NOTE: (- x) negates x
+		return foldNumbers("-", 0, a, func(x, y int) any {
+			return x - y
+		}, func(x, y float64) any {
+			return x - y
+		})
+	}
+
+	return foldNumbers("-", a[0], a[1:], func(x, y int) any {
+		return x - y
+	}, func(x, y float64) any {
+		return x - y
+	})
+}
+
+func toyMul(a ...any) any {
+	return foldNumbers("*", 1, a, func(x, y int) any {
+		return x * y
+	}, func(x, y float64) any {
+		return x * y
+	})
+}
+
+func toyDiv(a ...any) any {
+	if len(a) == 0 {
+		return newError("/: expected at least one argument")
+	}
+
+	first, rest := a[0], a[1:]
+	if len(a) == 1 {
+		// NOTE: (/ x) is the reciprocal of x
+		first, rest = 1, a
+	}
+
+	return foldNumbers("/", first, rest, func(x, y int) any {
+		if y == 0 {
+			return newError("/: division by zero")
+		}
+		if x%y == 0 {
+			return x / y
+		}
+		// NOTE: ints that don't divide evenly produce a float
+		return float64(x) / float64(y)
+	}, func(x, y float64) any {
+		if y == 0 {
+			return newError("/: division by zero")
+		}
+		return x / y
+	})
+}
+
+func toyMod(a ...any) any {
+	if len(a) < 2 {
+		return newError("%%: expected at least two arguments")
+	}
+
+	return foldNumbers("%", a[0], a[1:], func(x, y int) any {
+		if y == 0 {
+			return newError("%%: division by zero")
+		}
+		return x % y
+	}, func(x, y float64) any {
+		if y == 0 {
+			return newError("%%: division by zero")
+		}
+		return math.Mod(x, y)
+	})
+}
+
+// foldNumbers applies op left to right starting from initial,
+// using intOp while both sides are ints and floatOp otherwise
+func foldNumbers(name string, initial any, a []any, intOp func(x, y int) any, floatOp func(x, y float64) any) any {
+	acc := initial
+	if !isNumber(acc) {
+		return newError("%s: expected a number, got %s", name, describeType(acc))
+	}
+
+	for _, v := range a {
+		if !isNumber(v) {
+			return newError("%s: expected a number, got %s", name, describeType(v))
+		}
+
+		accInt, accIsInt := acc.(int)
+		vInt, vIsInt := v.(int)
+		if accIsInt && vIsInt {
+			acc = intOp(accInt, vInt)
+		} else {
+			accFloat, _ := toFloat(acc)
+			vFloat, _ := toFloat(v)
+			acc = floatOp(accFloat, vFloat)
+		}
+
+		// NOTE: the ops raise errors such as division by zero
+		if err, isErr := acc.(*Error); isErr {
+			return err
+		}
+	}
+
+	return acc
+}
@@ -0,0 +1,291 @@
+package interpreter
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	// SELECT_CLOSED is returned by selectStream once all of its streams are closed
+	SELECT_CLOSED = -1
+	// SELECT_DEFAULT is returned by selectStream when no stream had a value
+	SELECT_DEFAULT = -2
+	// SELECT_TIMEOUT is returned by selectStream when no stream had a value in time
+	SELECT_TIMEOUT = -3
+)
+
+// newStream creates a stream with a buffer of size, seeded with values
+func newStream(size int, values []any) chan any {
+	ch := make(chan any, size)
+	for _, v := range values {
+		ch <- v
+	}
+
+	return ch
+}
+
+// streamCapacity validates the (@capacity n) of a stream seeded with count values
+func streamCapacity(capacity any, count int) (int, *Error) {
+	n, ok := toIndex(capacity)
+	if !ok || n < 0 {
+		return 0, newError("@stream: capacity must be a non-negative whole number, got %s", FormatValue(capacity))
+	}
+	if n < count {
+		return 0, newError("@stream: capacity %d is too small for %d values", n, count)
+	}
+
+	return n, nil
+}
+
+// streamTimeout converts a timeout in ms to a duration
+func streamTimeout(name string, ms any) (time.Duration, *Error) {
+	n, ok := toFloat(ms)
+	if !ok || n < 0 {
+		return 0, newError("%s: timeout must be a non-negative number of ms, got %s", name, FormatValue(ms))
+	}
+
+	return time.Duration(n * float64(time.Millisecond)), nil
+}
+
+// sendStream pushes v onto the stream and reports whether it was accepted in time,
+// a negative wait blocks until a reader takes it and no wait doesn't block at all.
+// Waiting stops with the error of ctx once it's done
+func sendStream(ctx context.Context, name string, ch chan any, v any, wait time.Duration) (sent bool, err *Error) {
+	// NOTE: go panics when sending on a closed channel
+	defer func() {
+		if recover() != nil {
+			sent, err = false, newError("%s: the stream is closed", name)
+		}
+	}()
+
+	switch {
+	case wait < 0:
+		select {
+		case ch <- v:
+			return true, nil
+		case <-ctx.Done():
+			return false, interrupted(ctx)
+		}
+	case wait == 0:
+		select {
+		case ch <- v:
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case ch <- v:
+		return true, nil
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, interrupted(ctx)
+	}
+}
+
+// receiveStream waits for the next value of the stream, ok is false once it's closed.
+// Waiting stops with the error of ctx once it's done
+func receiveStream(ctx context.Context, ch chan any) (v any, ok bool, err *Error) {
+	select {
+	case v, ok = <-ch:
+		return v, ok, nil
+	case <-ctx.Done():
+		return nil, false, interrupted(ctx)
+	}
+}
+
+// toyPush blocks until a reader takes the value, an optional timeout in ms
+// raises an error when it's not taken in time. Lists and hashes are set with @set
+func toyPush(ctx context.Context, a ...any) any {
+	if err := expectArgs("@push", a, 2); err != nil {
+		return err
+	}
+
+	ch, ok := a[0].(chan any)
+	if !ok {
+		return toySet(ctx, a...)
+	}
+
+	wait := time.Duration(-1)
+	if len(a) > 2 {
+		w, err := streamTimeout("@push", a[2])
+		if err != nil {
+			return err
+		}
+		wait = w
+	}
+
+	sent, err := sendStream(ctx, "@push", ch, a[1], wait)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		return newError("@push: the value wasn't taken within %s ms", FormatValue(a[2]))
+	}
+
+	return nil
+}
+
+// toyTryPush returns whether the value was taken right away,
+// or within the optional timeout in ms
+func toyTryPush(ctx context.Context, a ...any) any {
+	if err := expectArgs("@try-push", a, 2); err != nil {
+		return err
+	}
+
+	ch, ok := a[0].(chan any)
+	if !ok {
+		return newError("@try-push: expected a stream, got %s", describeType(a[0]))
+	}
+
+	wait := time.Duration(0)
+	if len(a) > 2 {
+		w, err := streamTimeout("@try-push", a[2])
+		if err != nil {
+			return err
+		}
+		wait = w
+	}
+
+	sent, err := sendStream(ctx, "@try-push", ch, a[1], wait)
+	if err != nil {
+		return err
+	}
+
+	return sent
+}
+
+// streamConcurrency is the optional number of go routines of a stream operator,
+// given after its stream
+func streamConcurrency(name string, a []any) (int, *Error) {
+	if len(a) < 3 {
+		return 1, nil
+	}
+
+	n, ok := toIndex(a[2])
+	if !ok || n < 1 {
+		return 0, newError("%s: concurrency must be a positive whole number, got %s", name, FormatValue(a[2]))
+	}
+
+	return n, nil
+}
+
+// pipeStream applies step to the values of in on as many go routines as workers
+// and sends the values it keeps on the returned stream, as they complete.
+// The returned stream is closed once in is closed and all of its values are done,
+// or once ctx is done
+func pipeStream(ctx context.Context, in chan any, workers int, step func(v any) (any, bool, error)) chan any {
+	out := make(chan any)
+	wg := sync.WaitGroup{}
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				v, ok, err := receiveStream(ctx, in)
+				if !ok || err != nil {
+					return
+				}
+
+				// NOTE: errors sent on the stream are passed on to the reader
+				if _, isErr := v.(*Error); !isErr {
+					r, keep, err := step(v)
+					switch {
+					case err != nil:
+						v = asToyError(err)
+					case keep:
+						v = r
+					default:
+						continue
+					}
+				}
+
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// selectStream waits for the first of the streams to have a value and returns its index.
+// Instead of waiting it returns SELECT_DEFAULT when hasDefault is set,
+// or SELECT_TIMEOUT once the timeout in ms is over when hasTimeout is set.
+// Closed streams are left out of the select, until all of them are closed.
+// Waiting stops with the error of ctx once it's done
+func selectStream(ctx context.Context, streams []any, hasDefault bool, timeout any, hasTimeout bool) (int, any, *Error) {
+	cases := []reflect.SelectCase{}
+	for _, s := range streams {
+		ch, ok := s.(chan any)
+		if !ok {
+			return 0, nil, newError("@select: expected a stream, got %s", describeType(s))
+		}
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+
+	switch {
+	case hasDefault:
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	case hasTimeout:
+		wait, err := streamTimeout("@select", timeout)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)})
+	}
+
+	// NOTE: an empty select would block forever
+	if len(cases) == 0 {
+		return SELECT_CLOSED, nil, nil
+	}
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+
+	open := len(streams)
+	for {
+		chosen, v, ok := reflect.Select(cases)
+		switch {
+		case chosen == len(cases)-1:
+			return 0, nil, interrupted(ctx)
+		case chosen == len(streams) && hasDefault:
+			return SELECT_DEFAULT, nil, nil
+		case chosen == len(streams):
+			return SELECT_TIMEOUT, nil, nil
+		case !ok:
+			// NOTE: the select ignores the zero value in place of a closed stream
+			cases[chosen].Chan = reflect.Value{}
+			open -= 1
+			if open == 0 {
+				return SELECT_CLOSED, nil, nil
+			}
+			continue
+		}
+
+		value := v.Interface()
+		// NOTE: errors sent on the stream are raised by the reader
+		if err, isErr := value.(*Error); isErr {
+			return 0, nil, err
+		}
+
+		return chosen, value, nil
+	}
+}
@@ -0,0 +1,491 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"toyscript/parser"
+)
+
+// runBoth runs src on both engines and fails when they disagree
+func runBoth(t *testing.T, src string) (string, string) {
+	t.Helper()
+
+	treeValue, treeErr := runEngine(t, ENGINE_TREE, src)
+	vmValue, vmErr := runEngine(t, ENGINE_VM, src)
+	if treeValue != vmValue || treeErr != vmErr {
+		t.Fatalf("engines disagree\ntree: %s %s\nvm:   %s %s", treeValue, treeErr, vmValue, vmErr)
+	}
+
+	return treeValue, treeErr
+}
+
+func TestStreamCapacity(t *testing.T) {
+	tests := []struct {
+		capacity any
+		count    int
+		want     int
+		err      string
+	}{
+		{0, 0, 0, ""},
+		{2, 1, 2, ""},
+		{3.0, 3, 3, ""},
+		{1, 2, 0, "capacity 1 is too small for 2 values"},
+		{-1, 0, 0, "capacity must be a non-negative whole number, got -1"},
+		{1.5, 0, 0, "capacity must be a non-negative whole number, got 1.5"},
+		{"2", 0, 0, `capacity must be a non-negative whole number, got "2"`},
+	}
+
+	for _, tt := range tests {
+		n, err := streamCapacity(tt.capacity, tt.count)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%v for %d values: unexpected error %s", tt.capacity, tt.count, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%v for %d values: got error %v, want %q", tt.capacity, tt.count, err, tt.err)
+		case n != tt.want:
+			t.Errorf("%v for %d values: got %d, want %d", tt.capacity, tt.count, n, tt.want)
+		}
+	}
+}
+
+func TestStreamLiteral(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		value string
+		err   string
+	}{
+		{"buffered values", `(@len (@stream 1 2 3))`, "3", ""},
+		{"pull in order", `
+			(@var (s (@stream 1 2)))
+			(@list (@pull s) (@pull s))`, "(@list 1 2)", ""},
+		{"room to push", `
+			(@var (s (@stream (@capacity 3) 1)))
+			(@push s 2)
+			(@len s)`, "2", ""},
+		{"collect once closed", `
+			(@var (s (@stream (@capacity 2) 1)))
+			(@push s 2)
+			(@close s)
+			(@collect s)`, "(@list 1 2)", ""},
+		{"await the next value", `
+			(@var (s (@stream 1)))
+			(@close s)
+			(@list (@await s) (@await s))`, "(@list 1 nil)", ""},
+		{"pull from a drained stream", `
+			(@var (s (@stream 1)))
+			(@close s)
+			(@list (@pull s) (@pull s))`, "(@list 1 nil)", ""},
+		{"close twice", `
+			(@var (s (@stream)))
+			(@close s)
+			(@close s)`, "", "the stream is already closed"},
+		{"capacity too small", `(@stream (@capacity 1) 1 2)`, "", "@stream: capacity 1 is too small for 2 values"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := runBoth(t, tt.src)
+			if value != tt.value {
+				t.Errorf("got %s, want %s", value, tt.value)
+			}
+			if !strings.Contains(err, tt.err) || (tt.err == "") != (err == "") {
+				t.Errorf("got error %q, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// closedStream is a closed stream seeded with values
+func closedStream(values ...any) chan any {
+	ch := newStream(len(values), values)
+	close(ch)
+	return ch
+}
+
+func TestSelectStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		streams    []any
+		hasDefault bool
+		timeout    any
+		hasTimeout bool
+		chosen     int
+		value      any
+		err        string
+	}{
+		{"first ready", []any{newStream(0, nil), newStream(1, []any{5})}, false, nil, false, 1, 5, ""},
+		{"default", []any{newStream(0, nil)}, true, nil, false, SELECT_DEFAULT, nil, ""},
+		{"timeout", []any{newStream(0, nil)}, false, 10, true, SELECT_TIMEOUT, nil, ""},
+		{"ready before the timeout", []any{newStream(1, []any{"a"})}, false, 1000, true, 0, "a", ""},
+		{"skips closed streams", []any{closedStream(), newStream(1, []any{2})}, false, nil, false, 1, 2, ""},
+		{"drains closed streams", []any{closedStream(3)}, false, nil, false, 0, 3, ""},
+		{"all closed", []any{closedStream(), closedStream()}, false, nil, false, SELECT_CLOSED, nil, ""},
+		{"all closed with a default", []any{closedStream()}, true, nil, false, SELECT_CLOSED, nil, ""},
+		{"all closed with a timeout", []any{closedStream()}, false, 1000, true, SELECT_CLOSED, nil, ""},
+		{"no streams", []any{}, false, nil, false, SELECT_CLOSED, nil, ""},
+		{"raises errors", []any{closedStream(newError("boom"))}, false, nil, false, 0, nil, "boom"},
+		{"not a stream", []any{[]any{1}}, false, nil, false, 0, nil, "@select: expected a stream, got list"},
+		{"bad timeout", []any{newStream(0, nil)}, false, -1, true, 0, nil, "@select: timeout must be a non-negative number of ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			chosen, value, err := selectStream(context.Background(), tt.streams, tt.hasDefault, tt.timeout, tt.hasTimeout)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chosen != tt.chosen || value != tt.value {
+				t.Errorf("got %d %v, want %d %v", chosen, value, tt.chosen, tt.value)
+			}
+			if chosen == SELECT_TIMEOUT && time.Since(start) < 10*time.Millisecond {
+				t.Errorf("timed out after %s, want 10ms", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestSelectExpression(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		value string
+	}{
+		{"value in the branch", `
+			(@var (a (@stream)) (b (@stream 4)))
+			(@select (@when a (@list "a" value)) (@when b (@list "b" value)))`, `(@list "b" 4)`},
+		{"default", `
+			(@var (s (@stream)))
+			(@select (@when s value) (@default "nothing yet"))`, `"nothing yet"`},
+		{"timeout", `
+			(@var (s (@stream)))
+			(@select (@when s value) (@timeout 10 "gave up"))`, `"gave up"`},
+		{"all closed", `
+			(@var (a (@stream)) (b (@stream)))
+			(@close a)
+			(@close b)
+			(@select (@when a value) (@when b value))`, "nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := runBoth(t, tt.src)
+			if err != "" {
+				t.Fatal(err)
+			}
+			if value != tt.value {
+				t.Errorf("got %s, want %s", value, tt.value)
+			}
+		})
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	tests := []struct {
+		name string
+		ch   chan any
+		wait time.Duration
+		sent bool
+		err  string
+	}{
+		{"room in the buffer", newStream(1, nil), -1, true, ""},
+		{"try with room", newStream(1, nil), 0, true, ""},
+		{"try when full", newStream(1, []any{1}), 0, false, ""},
+		{"try without a reader", newStream(0, nil), 0, false, ""},
+		{"timeout when full", newStream(1, []any{1}), 10 * time.Millisecond, false, ""},
+		{"closed", closedStream(), -1, false, "@push: the stream is closed"},
+		{"try when closed", closedStream(), 0, false, "@push: the stream is closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			sent, err := sendStream(context.Background(), "@push", tt.ch, 2, tt.wait)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sent != tt.sent {
+				t.Errorf("got sent %t, want %t", sent, tt.sent)
+			}
+			if tt.wait > 0 && !sent && time.Since(start) < tt.wait {
+				t.Errorf("gave up after %s, want %s", time.Since(start), tt.wait)
+			}
+		})
+	}
+}
+
+func TestSendStreamBlocks(t *testing.T) {
+	ch := newStream(0, nil)
+	done := make(chan bool)
+	go func() {
+		sent, _ := sendStream(context.Background(), "@push", ch, 1, -1)
+		done <- sent
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("the push returned without a reader")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if v := <-ch; v != 1 {
+		t.Fatalf("got %v, want 1", v)
+	}
+	if !<-done {
+		t.Fatal("expected the value to be sent once taken")
+	}
+}
+
+func TestPush(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		value string
+		err   string
+	}{
+		{"taken by a reader", `
+			(@var (s (@stream)))
+			(@async (@push s 1))
+			(@pull s)`, "1", ""},
+		{"timeout", `
+			(@var (s (@stream)))
+			(@push s 1 10)`, "", "@push: the value wasn't taken within 10 ms"},
+		{"closed", `
+			(@var (s (@stream)))
+			(@close s)
+			(@push s 1)`, "", "@push: the stream is closed"},
+		{"bad timeout", `(@push (@stream) 1 "soon")`, "", "@push: timeout must be a non-negative number of ms"},
+		{"try with room", `
+			(@var (s (@stream (@capacity 1))))
+			(@list (@try-push s 1) (@try-push s 2) (@collect (@seq (@close s) s)))`, "(@list true false (@list 1))", ""},
+		{"try timeout", `(@try-push (@stream) 1 10)`, "false", ""},
+		{"try closed", `
+			(@var (s (@stream)))
+			(@close s)
+			(@try-push s 1)`, "", "@try-push: the stream is closed"},
+		{"try a list", `(@try-push (@list) 1)`, "", "@try-push: expected a stream, got list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := runBoth(t, tt.src)
+			if value != tt.value {
+				t.Errorf("got %s, want %s", value, tt.value)
+			}
+			if !strings.Contains(err, tt.err) || (tt.err == "") != (err == "") {
+				t.Errorf("got error %q, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCancelWhileWaiting(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"pull", `(@pull s)`},
+		{"await", `(@await s)`},
+		{"collect", `(@collect s)`},
+		{"has", `(@has s 1)`},
+		{"push", `(@push s 1)`},
+		{"set", `(@set s 1)`},
+		{"push with a timeout", `(@push s 1 1000)`},
+		{"select", `(@select (@when s value))`},
+		{"select with a timeout", `(@select (@when s value) (@timeout 1000 nil))`},
+		{"async result", `(@await (@async (@pull s)))`},
+		{"map", `(@collect (@map (@func (x) (x)) s))`},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+			t.Run(tt.name+"/"+engine, func(t *testing.T) {
+				program, err := parser.ParseSource("<test>", "(@var (s (@stream)))\n"+tt.src)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// NOTE: nothing is ever pushed or pulled, only the deadline stops the script
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				defer cancel()
+
+				e, _ := NewEngine(engine)
+				_, err = e.Run(ctx, "", program)
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("got %v, want the deadline", err)
+				}
+			})
+		}
+	}
+}
+
+// drain reads the stream until it's closed, failing when it takes longer than a second
+func drain(t *testing.T, ch chan any) []any {
+	t.Helper()
+
+	values := []any{}
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return values
+			}
+			values = append(values, v)
+		case <-time.After(time.Second):
+			t.Fatalf("the stream wasn't closed, got %v so far", values)
+		}
+	}
+}
+
+func TestMapStreamIsLazy(t *testing.T) {
+	calls := make(chan any, 2)
+	double := funcType(func(a ...any) any {
+		calls <- a[0]
+		return a[0].(int) * 2
+	})
+
+	in := newStream(0, nil)
+	out, ok := toyMap(context.Background(), double, in).(chan any)
+	if !ok {
+		t.Fatal("expected a stream")
+	}
+
+	// NOTE: nothing is mapped before a value arrives
+	select {
+	case v := <-calls:
+		t.Fatalf("mapped %v before it was pushed", v)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	in <- 1
+	if v := <-out; v != 2 {
+		t.Fatalf("got %v, want 2", v)
+	}
+	if v := <-calls; v != 1 {
+		t.Fatalf("mapped %v, want 1", v)
+	}
+
+	close(in)
+	if values := drain(t, out); len(values) != 0 {
+		t.Fatalf("got %v after the input drained", values)
+	}
+}
+
+func TestStreamConcurrency(t *testing.T) {
+	const workers = 4
+
+	// NOTE: every call waits for all the workers to be busy,
+	// which only happens when they run at the same time
+	started := make(chan bool, workers)
+	release := make(chan bool)
+	wait := funcType(func(a ...any) any {
+		started <- true
+		select {
+		case <-release:
+			return a[0]
+		case <-time.After(time.Second):
+			return newError("only some of the workers were running")
+		}
+	})
+
+	in := newStream(workers, []any{1, 2, 3, 4})
+	close(in)
+	out := toyMap(context.Background(), wait, in, workers).(chan any)
+
+	for range workers {
+		<-started
+	}
+	close(release)
+
+	values := drain(t, out)
+	if len(values) != workers {
+		t.Fatalf("got %v, want %d values", values, workers)
+	}
+	for _, v := range values {
+		if err, isErr := v.(*Error); isErr {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamOperators(t *testing.T) {
+	double := funcType(func(a ...any) any {
+		if a[0] == 3 {
+			return newError("three")
+		}
+		return a[0].(int) * 2
+	})
+	even := funcType(func(a ...any) any {
+		return a[0].(int)%2 == 0
+	})
+
+	tests := []struct {
+		name   string
+		result func(in chan any) any
+		values []any
+		want   string
+		err    string
+	}{
+		{"map", func(in chan any) any { return toyMap(context.Background(), double, in) }, []any{1, 2}, "(@list 2 4)", ""},
+		{"filter", func(in chan any) any { return toyFilter(context.Background(), even, in) }, []any{1, 2, 3, 4}, "(@list 2 4)", ""},
+		{"map on workers", func(in chan any) any { return toyMap(context.Background(), double, in, 2) }, []any{1, 2}, "", ""},
+		{"errors of the func", func(in chan any) any { return toyMap(context.Background(), double, in) }, []any{1, 3}, "(@list 2 <error: three>)", ""},
+		{"errors on the stream", func(in chan any) any { return toyFilter(context.Background(), even, in) }, []any{newError("sent"), 2}, "(@list <error: sent> 2)", ""},
+		{"filter result", func(in chan any) any { return toyFilter(context.Background(), double, in) }, []any{1}, "", "@filter: expected the function to return a boolean, got number"},
+		{"bad concurrency", func(in chan any) any { return toyMap(context.Background(), double, in, 0) }, nil, "", "@map: concurrency must be a positive whole number, got 0"},
+		{"concurrency on a list", func(in chan any) any { return toyMap(context.Background(), double, []any{1}, 2) }, nil, "", "@map: concurrency is only supported for streams"},
+		{"concurrency on a hash", func(in chan any) any { return toyFilter(context.Background(), even, map[string]any{}, 2) }, nil, "", "@filter: concurrency is only supported for streams"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := newStream(len(tt.values), tt.values)
+			close(in)
+
+			result := tt.result(in)
+			if err, isErr := result.(*Error); isErr {
+				if tt.err == "" || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+
+			// NOTE: the output is closed once the input is drained
+			values := drain(t, result.(chan any))
+			if tt.err != "" {
+				if len(values) != 1 || !strings.Contains(FormatValue(values[0]), tt.err) {
+					t.Fatalf("got %v, want the error %q", values, tt.err)
+				}
+				return
+			}
+			if tt.want == "" {
+				if len(values) != len(tt.values) {
+					t.Fatalf("got %v, want %d values", values, len(tt.values))
+				}
+				return
+			}
+			if got := FormatValue(values); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"toyscript/lexer"
+)
+
+func TestAsyncSharedContainers(t *testing.T) {
+	branches := []string{}
+	for idx := range 16 {
+		branches = append(branches, fmt.Sprintf(`(@seq (@var (k "%d")) (set k (@len h)))`, idx))
+	}
+
+	// NOTE: run with -race, every branch sets and reads the hash and the list
+	// of its func while the others do
+	src := `
+		(@var (fill (@func () (
+			(@var (h (@hash)) (l (@list 0 0 0 0)))
+			(@var (set (@func (k v) (
+				(@set h k v)
+				(@set l (% (@len h) 4) (@get h k))
+				(@has l v)))))
+			(@collect (@async ` + strings.Join(branches, " ") + `))
+			(@list (@len h) (@len l))))))
+		(fill)`
+
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(engine, func(t *testing.T) {
+			for range 20 {
+				value, err := runEngine(t, engine, src)
+				if err != "" {
+					t.Fatal(err)
+				}
+				if value != "(@list 16 4)" {
+					t.Fatalf("got %s, want (@list 16 4)", value)
+				}
+			}
+		})
+	}
+}
+
+func TestContainerLocks(t *testing.T) {
+	busy := []any{1}
+	other := map[string]any{"l": []any{2}}
+	for lockOf(other) == lockOf(busy) || lockOf(other["l"]) == lockOf(busy) {
+		other = map[string]any{"l": []any{2}}
+	}
+
+	// NOTE: a container being set doesn't hold up the others
+	mu := lockOf(busy)
+	mu.Lock()
+	defer mu.Unlock()
+
+	done := make(chan string)
+	go func() {
+		done <- FormatValue(other)
+	}()
+
+	select {
+	case got := <-done:
+		if got != `(@hash ("l" (@list 2)))` {
+			t.Errorf("got %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("formatting waited on the lock of another container")
+	}
+}
+
+func TestAsyncBranchBindings(t *testing.T) {
+	src := `
+		(@var (run (@func (n) (
+			(@var (results (@collect (@async (@ordered)
+				(@seq (@var (x (+ n 1))) x)
+				(@seq (@var (x (* n 10))) x)))))
+			(@list results (@get results 0) n)))))
+		(run 2)`
+
+	value, err := runBoth(t, src)
+	if err != "" {
+		t.Fatal(err)
+	}
+	if value != "(@list (@list 3 20) 3 2)" {
+		t.Errorf("got %s, want (@list (@list 3 20) 3 2)", value)
+	}
+}
+
+func TestCaughtErrors(t *testing.T) {
+	const caughtBoom = `(@var (e (@try (@error "boom") (@catch err err))))`
+
+	tests := []struct {
+		name  string
+		src   string
+		value string
+		err   string
+	}{
+		{"value", caughtBoom + ` (@seq e)`, "<error: boom>", ""},
+		{"stored in a list", caughtBoom + ` (@get (@get (@list e) 0) "message")`, `"boom"`, ""},
+		{"stored in a hash", caughtBoom + ` (@get (@hash ("e" e)) "e")`, "<error: boom>", ""},
+		{"passed to a func", caughtBoom + `
+			(@var (id (@func (x) ((@seq x)))))
+			(@get (id e) "message")`, `"boom"`, ""},
+		{"returned from a func", `
+			(@var (catch (@func () ((@try (@error "boom") (@catch err err))))))
+			(@list (catch) (@get (catch) "message"))`, `(@list <error: boom> "boom")`, ""},
+		{"compared", caughtBoom + ` (= e e)`, "true", ""},
+		{"raised again", caughtBoom + ` (@try (@error e) (@catch again (@get again "message")))`, `"boom"`, ""},
+		{"raised again uncaught", caughtBoom + ` (@error e)`, "", "boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := runBoth(t, tt.src)
+			if value != tt.value {
+				t.Errorf("got %s, want %s", value, tt.value)
+			}
+			if !strings.Contains(err, tt.err) || (tt.err == "") != (err == "") {
+				t.Errorf("got error %q, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWithFrameCopies(t *testing.T) {
+	err := newError("boom")
+	first := err.withFrame("f", lexer.Position{Line: 1, Column: 1})
+	second := err.withFrame("g", lexer.Position{Line: 2, Column: 1})
+
+	if len(err.Trace) != 0 {
+		t.Errorf("the raised error gathered %v", err.Trace)
+	}
+	if len(first.Trace) != 1 || len(second.Trace) != 1 || second.Trace[0].Function != "g" {
+		t.Errorf("got traces %v and %v, want one frame each", first.Trace, second.Trace)
+	}
+}
@@ -0,0 +1,291 @@
+package interpreter
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"toyscript/ast"
+	"toyscript/parser"
+)
+
+// NOTE: native modules are registered by go code and take precedence over files.
+// File modules are keyed by their canonical path, the absolute path with
+// symlinks resolved, so every spelling of an import shares a single instance.
+// Import paths are resolved against the directory of the importing module and
+// then against every directory of the search path, TOYPATH by default.
+// Paths starting with ./ or ../ are only resolved against the importing module.
+
+type (
+	// nativeRegistry holds the modules implemented in go, by their import path
+	nativeRegistry struct {
+		sync.RWMutex
+		modules map[string]map[string]funcType
+	}
+
+	// ModuleLoader resolves, parses and caches the file modules of an engine
+	ModuleLoader struct {
+		searchPath []string
+		sources    map[string]*ast.ProgramStatement
+		exports    map[string]*frame
+		// stack are the modules being executed, the innermost last
+		stack []string
+	}
+)
+
+var natives = nativeRegistry{modules: map[string]map[string]funcType{}}
+
+// RegisterModule makes a module implemented in go importable by path,
+// its members are called like built-ins. Registering a path again replaces the module.
+func RegisterModule(path string, members map[string]funcType) {
+	natives.Lock()
+	defer natives.Unlock()
+
+	natives.modules[path] = maps.Clone(members)
+}
+
+// nativeModule returns a frame with the members of the go module registered at path,
+// it has no parent so lookups stop at its members
+func nativeModule(path string) (*frame, bool) {
+	natives.RLock()
+	defer natives.RUnlock()
+
+	members, ok := natives.modules[path]
+	if !ok {
+		return nil, false
+	}
+
+	f := newFrame(nil)
+	for name, fn := range members {
+		f.set(name, fn)
+	}
+	return f, true
+}
+
+// NativeMembers returns the member names of the go module registered at path, sorted
+func NativeMembers(path string) ([]string, bool) {
+	natives.RLock()
+	defer natives.RUnlock()
+
+	members, ok := natives.modules[path]
+	if !ok {
+		return nil, false
+	}
+
+	return slices.Sorted(maps.Keys(members)), true
+}
+
+func NewModuleLoader() *ModuleLoader {
+	searchPath := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("TOYPATH")) {
+		if dir != "" {
+			searchPath = append(searchPath, dir)
+		}
+	}
+
+	return &ModuleLoader{
+		searchPath: searchPath,
+		sources:    map[string]*ast.ProgramStatement{},
+		exports:    map[string]*frame{},
+	}
+}
+
+// canonicalPath is the absolute path with symlinks resolved, as far as the file exists
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real, nil
+	}
+
+	return abs, nil
+}
+
+// displayPath shortens a canonical path to be relative to the working dir, when it's below it
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return rel
+}
+
+// Enter runs fn with path as the importing module, used for the main script
+func (l *ModuleLoader) Enter(path string, fn func() error) error {
+	canonical, err := canonicalPath(path)
+	if err != nil {
+		return err
+	}
+
+	l.stack = append(l.stack, canonical)
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+
+	return fn()
+}
+
+// importer is the directory imports are resolved against, the working dir outside of modules
+func (l *ModuleLoader) importer() string {
+	if len(l.stack) == 0 {
+		return "."
+	}
+
+	return filepath.Dir(l.stack[len(l.stack)-1])
+}
+
+// Resolve finds the canonical path of an import made by the current module
+func (l *ModuleLoader) Resolve(importPath string) (string, error) {
+	dirs := []string{l.importer()}
+	switch {
+	case filepath.IsAbs(importPath):
+		dirs = []string{""}
+	case strings.HasPrefix(importPath, "./"), strings.HasPrefix(importPath, "../"):
+	default:
+		dirs = append(dirs, l.searchPath...)
+	}
+
+	for _, dir := range dirs {
+		path, err := canonicalPath(filepath.Join(dir, importPath))
+		if err != nil {
+			return "", err
+		}
+
+		// NOTE: modules preloaded from an artifact don't need to exist on disk
+		if _, ok := l.sources[path]; ok {
+			return path, nil
+		}
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+
+	searched := []string{}
+	for _, dir := range dirs {
+		searched = append(searched, displayPath(filepath.Join(dir, importPath)))
+	}
+	return "", newError("failed to resolve import %s, tried %s", importPath, strings.Join(searched, ", "))
+}
+
+// Parse reads and parses the module at the canonical path, unless it was preloaded
+func (l *ModuleLoader) Parse(path string) (*ast.ProgramStatement, error) {
+	if program, ok := l.sources[path]; ok {
+		return program, nil
+	}
+
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newError("failed to read import %s", displayPath(path))
+	}
+
+	program, err := parser.ParseSource(displayPath(path), string(fileBytes))
+	if err != nil {
+		return nil, newError("failed to parse import %s\n%s", displayPath(path), err.Error())
+	}
+
+	l.sources[path] = program
+	return program, nil
+}
+
+// cycle reports an import cycle when the module at the canonical path is already being loaded
+func (l *ModuleLoader) cycle(path string) error {
+	idx := slices.Index(l.stack, path)
+	if idx < 0 {
+		return nil
+	}
+
+	cycle := []string{}
+	for _, p := range slices.Concat(l.stack[idx:], []string{path}) {
+		cycle = append(cycle, displayPath(p))
+	}
+	return newError("import cycle: %s", strings.Join(cycle, " -> "))
+}
+
+// FindCycle follows the file imports of the module at the canonical path without
+// executing them and returns the first import cycle it reaches, back to a module
+// being loaded included. Imports which fail to resolve or parse are skipped.
+func (l *ModuleLoader) FindCycle(path string) error {
+	return l.findCycle(path, map[string]bool{})
+}
+
+func (l *ModuleLoader) findCycle(path string, done map[string]bool) error {
+	if err := l.cycle(path); err != nil {
+		return err
+	}
+	if done[path] {
+		return nil
+	}
+	done[path] = true
+
+	program, err := l.Parse(path)
+	if err != nil {
+		return nil
+	}
+
+	l.stack = append(l.stack, path)
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+
+	for _, s := range program.Body {
+		imprt, ok := s.(*ast.ImportStatement)
+		if !ok {
+			continue
+		}
+
+		for _, importPath := range slices.Sorted(maps.Values(imprt.Imports)) {
+			if _, isNative := NativeMembers(importPath); isNative {
+				continue
+			}
+
+			resolved, err := l.Resolve(importPath)
+			if err != nil {
+				continue
+			}
+			if err := l.findCycle(resolved, done); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// load returns the exports of the module at the canonical path,
+// the module is executed by run on its first import only
+func (l *ModuleLoader) load(path string, run func(p *ast.ProgramStatement) (*frame, error)) (*frame, error) {
+	if exports, ok := l.exports[path]; ok {
+		return exports, nil
+	}
+
+	if err := l.cycle(path); err != nil {
+		return nil, err
+	}
+
+	program, err := l.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l.stack = append(l.stack, path)
+	exports, err := run(program)
+	l.stack = l.stack[:len(l.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	l.exports[path] = exports
+	return exports, nil
+}
@@ -0,0 +1,260 @@
+package interpreter
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"toyscript/ast"
+)
+
+// runFile runs the script at path on a fresh engine and returns the formatted value or the error message
+func runFile(t *testing.T, engine string, path string) (string, string) {
+	t.Helper()
+
+	script, err := LoadScript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEngine(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script.Preload(e)
+
+	v, err := e.Run(context.Background(), path, script.Program)
+	if err != nil {
+		return "", err.Error()
+	}
+	return FormatValue(v), ""
+}
+
+func TestModuleScope(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.toy": `
+			(@var (x "from-main"))
+			(@import (a "./a.toy"))
+			(@list x (a.getX) a.x)`,
+		"a.toy": `
+			(@var (x "from-a") (getX (@func () (x))))
+			(@export x getX)`,
+		"leaky.toy": `
+			(@var (secret "main"))
+			(@import (b "./b.toy"))
+			(b.peek)`,
+		"b.toy": `
+			(@var (peek (@func () (secret))))
+			(@export peek)`,
+	})
+
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(engine, func(t *testing.T) {
+			value, errMsg := runFile(t, engine, filepath.Join(dir, "main.toy"))
+			if want := `(@list "from-main" "from-a" "from-a")`; value != want || errMsg != "" {
+				t.Errorf("got %s %s, want %s", value, errMsg, want)
+			}
+
+			// NOTE: a module doesn't see the globals of its importer
+			_, errMsg = runFile(t, engine, filepath.Join(dir, "leaky.toy"))
+			if !strings.Contains(errMsg, "failed to resolve ref secret") {
+				t.Errorf("got %q, want secret to be undefined in the module", errMsg)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	lib := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.toy":       ``,
+		"util.toy":       ``,
+		"pkg/inner.toy":  ``,
+		"pkg/helper.toy": ``,
+	})
+	writeFiles(t, lib, map[string]string{
+		"shared.toy": ``,
+		"util.toy":   ``,
+	})
+	t.Setenv("TOYPATH", lib)
+
+	dir, _ = canonicalPath(dir)
+	lib, _ = canonicalPath(lib)
+	tests := []struct {
+		name     string
+		importer string
+		path     string
+		want     string
+		err      string
+	}{
+		{"relative to the importer", "main.toy", "util.toy", filepath.Join(dir, "util.toy"), ""},
+		{"relative to a nested module", "pkg/inner.toy", "helper.toy", filepath.Join(dir, "pkg/helper.toy"), ""},
+		{"parent dir", "pkg/inner.toy", "../util.toy", filepath.Join(dir, "util.toy"), ""},
+		{"search path", "main.toy", "shared.toy", filepath.Join(lib, "shared.toy"), ""},
+		{"importer before search path", "main.toy", "util.toy", filepath.Join(dir, "util.toy"), ""},
+		{"./ skips the search path", "main.toy", "./shared.toy", "", "failed to resolve import ./shared.toy, tried "},
+		{"absolute", "main.toy", filepath.Join(lib, "util.toy"), filepath.Join(lib, "util.toy"), ""},
+		{"missing", "main.toy", "missing.toy", "", "failed to resolve import missing.toy, tried "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewModuleLoader()
+
+			var got string
+			err := l.Enter(filepath.Join(dir, tt.importer), func() (err error) {
+				got, err = l.Resolve(tt.path)
+				return err
+			})
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got %q %v, want an error containing %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleCache(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.toy":   `(@import (a "./a.toy") (b "./b.toy") (again "./shared.toy"))`,
+		"a.toy":      "(@import (s \"./shared.toy\"))\n(@var (x 1))\n(@export x)",
+		"b.toy":      "(@import (s \"./sub/../shared.toy\"))\n(@var (x 1))\n(@export x)",
+		"shared.toy": "(@var (x 1))\n(@export x)",
+	})
+
+	script, err := LoadScript(filepath.Join(dir, "main.toy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: every spelling of shared.toy is the same module, executed once
+	runs := map[*ast.ProgramStatement]int{}
+	i := NewInterpreter(map[string]inode{})
+	run := i.runModule
+	i.runModule = func(ctx context.Context, alias string, p *ast.ProgramStatement) (*frame, error) {
+		runs[p] += 1
+		return run(ctx, alias, p)
+	}
+
+	if err := i.Exec(filepath.Join(dir, "main.toy"), script.Program); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Errorf("got %d modules, want a, b and shared.toy", len(runs))
+	}
+	for p, n := range runs {
+		if n != 1 {
+			t.Errorf("module at %s ran %d times", p.Span, n)
+		}
+	}
+}
+
+func TestImportCycles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.toy": `(@import (a "./c/a.toy"))`,
+		"c/a.toy":  "(@import (b \"./b.toy\"))\n(@var (x 1))\n(@export x)",
+		"c/b.toy":  "(@import (a \"./a.toy\"))\n(@var (y 1))\n(@export y)",
+		"uses.toy": `(@import (stdio "std/stdio") (b "./c/b.toy"))`,
+	})
+	t.Chdir(dir)
+
+	want := "import cycle: c/a.toy -> c/b.toy -> c/a.toy"
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		if _, errMsg := runFile(t, engine, "main.toy"); errMsg != want {
+			t.Errorf("%s: got %q, want %q", engine, errMsg, want)
+		}
+	}
+
+	if _, err := BuildScript("main.toy"); err == nil || err.Error() != want {
+		t.Errorf("build: got %v, want %q", err, want)
+	}
+
+	l := NewModuleLoader()
+	path, _ := canonicalPath("c/a.toy")
+	if err := l.FindCycle(path); err == nil || err.Error() != want {
+		t.Errorf("FindCycle: got %v, want %q", err, want)
+	}
+
+	// NOTE: the importing module counts, a imports b which imports a again
+	err := l.Enter("c/a.toy", func() error {
+		path, _ := canonicalPath("c/b.toy")
+		return l.FindCycle(path)
+	})
+	if err == nil || err.Error() != want {
+		t.Errorf("FindCycle from a: got %v, want %q", err, want)
+	}
+
+	path, _ = canonicalPath("uses.toy")
+	if err := NewModuleLoader().FindCycle(path); err == nil {
+		t.Error("expected the cycle below uses.toy to be found")
+	}
+}
+
+func TestNativeModules(t *testing.T) {
+	members := map[string]funcType{
+		"twice": func(a ...any) any { return FormatValue(a[0]) + FormatValue(a[0]) },
+	}
+	RegisterModule("test/native", members)
+	// NOTE: the members are copied when registered
+	members["later"] = func(a ...any) any { return nil }
+
+	if got, ok := NativeMembers("test/native"); !ok || strings.Join(got, " ") != "twice" {
+		t.Errorf("got members %v, want twice", got)
+	}
+	if got, ok := NativeMembers("std/stdio"); !ok || strings.Join(got, " ") != "print read string" {
+		t.Errorf("got std/stdio members %v", got)
+	}
+	for _, path := range []string{"std/json", "std/http"} {
+		if _, ok := NativeMembers(path); !ok {
+			t.Errorf("expected %s to be registered", path)
+		}
+	}
+	if _, ok := NativeMembers("std/missing"); ok {
+		t.Error("expected std/missing not to be registered")
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		// NOTE: a file at the path of a native module is never loaded
+		"std/json": `(@var (parse (@func (s) ("from a file")))) (@export parse)`,
+		"native.toy": `
+			(@import (n "test/native") (json "std/json"))
+			(@list (n.twice 21) (json.parse "[1]"))`,
+		"member.toy": `
+			(@import (stdio "std/stdio"))
+			(@var (x "global"))
+			(@seq stdio.x)`,
+	})
+
+	for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+		t.Run(engine, func(t *testing.T) {
+			value, errMsg := runFile(t, engine, filepath.Join(dir, "native.toy"))
+			if want := `(@list "2121" (@list 1.0))`; value != want {
+				t.Errorf("got %s %s, want %s", value, errMsg, want)
+			}
+
+			// NOTE: members are looked up in the module only, not in the globals
+			_, errMsg = runFile(t, engine, filepath.Join(dir, "member.toy"))
+			if want := "failed to resolve ref stdio.x (imported)"; errMsg != want {
+				t.Errorf("got %q, want %q", errMsg, want)
+			}
+		})
+	}
+
+	// NOTE: registering a path again replaces the module
+	RegisterModule("test/native", map[string]funcType{"once": members["twice"]})
+	if got, _ := NativeMembers("test/native"); strings.Join(got, " ") != "once" {
+		t.Errorf("got members %v after registering again, want once", got)
+	}
+}
@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// NOTE: the standard library is made of native modules, imported by their std/ path
+//
+//	(@import (stdio "std/stdio") (web "std/http"))
+
+func init() {
+	RegisterModule("std/http", map[string]funcType{
+		"get": httpGet,
+	})
+	RegisterModule("std/json", map[string]funcType{
+		"parse": jsonParse,
+	})
+	RegisterModule("std/stdio", map[string]funcType{
+		"print":  stdioPrint,
+		"read":   stdioRead,
+		"string": stdioBuildStr,
+	})
+}
+
+func httpGet(a ...any) any {
+	if err := expectArgs("http.get", a, 1); err != nil {
+		return err
+	}
+
+	url, ok := a[0].(string)
+	if !ok {
+		return newError("http.get: expected a string url, got %s", describeType(a[0]))
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return newError("http.get: failed to get %s: %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return newError("http.get: failed to read response body for %s: %s", url, err.Error())
+	}
+
+	return body
+}
+
+func jsonParse(a ...any) any {
+	if err := expectArgs("json.parse", a, 1); err != nil {
+		return err
+	}
+
+	var data []byte
+	switch raw := a[0].(type) {
+	case []byte:
+		data = raw
+	case string:
+		data = []byte(raw)
+	default:
+		return newError("json.parse: expected bytes or a string, got %s", describeType(a[0]))
+	}
+
+	var parsed any
+	err := json.Unmarshal(data, &parsed)
+	if err != nil {
+		return newError("json.parse: %s", err.Error())
+	}
+
+	return parsed
+}
+
+func stdioPrint(v ...any) any {
+	values := []any{}
+	for _, vi := range v {
+		values = append(values, snapshotValue(vi))
+	}
+
+	fmt.Println(values...)
+	return nil
+}
+
+func stdioRead(_ ...any) any {
+	reader := bufio.NewReader(os.Stdin)
+	message, _ := reader.ReadString('\n')
+	return strings.Trim(message, " \n\r\t")
+}
+
+func stdioBuildStr(v ...any) any {
+	str := strings.Builder{}
+	for _, vi := range v {
+		if vi == nil {
+			continue
+		}
+
+		s, ok := vi.(string)
+		if !ok {
+			return newError("stdio.string: expected strings, got %s", describeType(vi))
+		}
+		str.WriteString(s)
+	}
+
+	return str.String()
+}
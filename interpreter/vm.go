@@ -0,0 +1,420 @@
+package interpreter
+
+import (
+	"context"
+	"slices"
+
+	"toyscript/ast"
+)
+
+type (
+	// VM executes compiled programs, it shares the globals,
+	// built-ins and the module loading of the interpreter
+	VM struct {
+		interp *Interpreter
+		// code of programs loaded from an artifact, they aren't compiled again
+		code map[*ast.ProgramStatement]*funcProto
+	}
+
+	// vmEnv holds the slots of a single func call,
+	// globals are the globals of the module the func was defined in
+	// and ctx is the ctx of the evaluation making the call
+	vmEnv struct {
+		slots   []any
+		parent  *vmEnv
+		exports *frame
+		globals *frame
+		ctx     context.Context
+	}
+
+	// vmHandler is an active @try in the current call
+	vmHandler struct {
+		target int
+		height int
+	}
+
+	vmUnbound struct{}
+)
+
+func NewVM(globals map[string]inode) *VM {
+	vm := &VM{NewInterpreter(globals), map[*ast.ProgramStatement]*funcProto{}}
+	vm.interp.runModule = vm.execModule
+	return vm
+}
+
+func newVMEnv(slots int, parent *vmEnv) *vmEnv {
+	e := &vmEnv{slots: make([]any, slots), parent: parent}
+	if parent != nil {
+		e.globals = parent.globals
+		e.ctx = parent.ctx
+	}
+	for idx := range e.slots {
+		// NOTE: missing args and bindings which haven't run yet
+		e.slots[idx] = vmUnbound{}
+	}
+
+	return e
+}
+
+// branch copies the env, its parents and its globals for an @async branch,
+// so the go routine sees the bindings as they were when it started
+func (e *vmEnv) branch() *vmEnv {
+	return e.branchWith(e.globals.snapshot())
+}
+
+func (e *vmEnv) branchWith(globals *frame) *vmEnv {
+	if e == nil {
+		return nil
+	}
+
+	return &vmEnv{slots: slices.Clone(e.slots), parent: e.parent.branchWith(globals), exports: e.exports, globals: globals, ctx: e.ctx}
+}
+
+// at returns the env depth funcs up
+func (e *vmEnv) at(depth int) *vmEnv {
+	for range depth {
+		e = e.parent
+	}
+
+	return e
+}
+
+func isUnbound(v any) bool {
+	_, ok := v.(vmUnbound)
+	return ok
+}
+
+// Preload registers already parsed file modules by their canonical path
+func (vm *VM) Preload(modules map[string]*ast.ProgramStatement) {
+	vm.interp.Preload(modules)
+}
+
+// Define binds a global visible to every script run afterwards
+func (vm *VM) Define(name string, v any) {
+	vm.interp.Define(name, v)
+}
+
+// Exec executes the script at filename, its imports are resolved relative to it
+func (vm *VM) Exec(filename string, p *ast.ProgramStatement) error {
+	_, err := vm.Run(context.Background(), filename, p)
+	return err
+}
+
+// Run executes the program until it finishes or ctx is done,
+// imports are resolved relative to filename unless it is empty
+func (vm *VM) Run(ctx context.Context, filename string, p *ast.ProgramStatement) (result any, err error) {
+	if filename == "" {
+		return vm.EvalContext(ctx, p)
+	}
+
+	err = vm.interp.loader.Enter(filename, func() error {
+		result, err = vm.EvalContext(ctx, p)
+		return err
+	})
+	return result, err
+}
+
+// EvalContext is Eval which stops at the next func call, or while waiting on a stream,
+// once ctx is done. Like in the interpreter the go routines still running keep ctx
+func (vm *VM) EvalContext(ctx context.Context, p *ast.ProgramStatement) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, newError("%v", r)
+		}
+	}()
+
+	proto := vm.compile(p)
+	env := newVMEnv(proto.slots, nil)
+	env.globals = vm.interp.globals
+	env.ctx = ctx
+	return vm.run(proto, env)
+}
+
+// Eval compiles and executes the program in the global scope
+// and returns the value of its last statement
+func (vm *VM) Eval(p *ast.ProgramStatement) (any, error) {
+	return vm.EvalContext(context.Background(), p)
+}
+
+func (vm *VM) execModule(ctx context.Context, alias string, p *ast.ProgramStatement) (*frame, error) {
+	proto := vm.compile(p)
+	env := newVMEnv(proto.slots, nil)
+	// NOTE: every module has its own globals, it only shares the built-ins
+	env.globals = newContextFrame(vm.interp.builtins, ctx)
+	env.ctx = ctx
+	if _, err := vm.run(proto, env); err != nil {
+		return nil, err
+	}
+
+	if env.exports == nil {
+		return nil, newError("module has not exports %s", alias)
+	}
+
+	return env.exports, nil
+}
+
+// compile returns the code of the program, unless it was loaded with it
+func (vm *VM) compile(p *ast.ProgramStatement) *funcProto {
+	if proto, ok := vm.code[p]; ok {
+		return proto
+	}
+
+	return Compile(p)
+}
+
+func (vm *VM) closure(p *funcProto, parent *vmEnv) ctxFuncType {
+	return func(ctx context.Context, a ...any) any {
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+
+		env := newVMEnv(p.slots, parent)
+		env.ctx = ctx
+		copy(env.slots[:p.params], a)
+
+		v, err := vm.run(p, env)
+		if err != nil {
+			// NOTE: the error is raised again at the call site
+			return asToyError(err).withFrame(p.name, p.span.Start)
+		}
+		return v
+	}
+}
+
+func (vm *VM) thunk(p *funcProto, env *vmEnv) func() (any, error) {
+	return func() (any, error) {
+		return vm.run(p, env)
+	}
+}
+
+func (vm *VM) global(globals *frame, name string, refType string) (any, error) {
+	v, ok := globals.get(name)
+	if !ok {
+		return nil, newError("failed to resolve ref %s (%s)", name, refType)
+	}
+
+	if vN, ok := v.(ast.Node); ok {
+		return vm.interp.execNode(vN, globals)
+	}
+
+	return v, nil
+}
+
+// run executes the code of p in env and returns the value left on the stack
+func (vm *VM) run(p *funcProto, env *vmEnv) (any, error) {
+	stack := make([]any, 0, 8)
+	handlers := []vmHandler{}
+
+	for pc := 0; pc < len(p.code); pc++ {
+		in := p.code[pc]
+
+		var err error
+		switch in.op {
+		case OP_CONST:
+			stack = append(stack, p.consts[in.a])
+		case OP_NIL:
+			stack = append(stack, nil)
+		case OP_POP:
+			stack = stack[:len(stack)-1]
+		case OP_GET_LOCAL:
+			var v any = vmUnbound{}
+			pairs := p.consts[in.a].([]int)
+			// NOTE: like the frames of the tree-walker, an unset binding
+			// falls back to the outer ones and then to the globals
+			for idx := 0; idx < len(pairs); idx += 2 {
+				if v = env.at(pairs[idx]).slots[pairs[idx+1]]; !isUnbound(v) {
+					break
+				}
+			}
+			if isUnbound(v) {
+				v, err = vm.global(env.globals, p.consts[in.b].(string), ast.REF_TYPE_DECLARED)
+			}
+			stack = append(stack, v)
+		case OP_SET_LOCAL:
+			env.slots[in.b] = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		case OP_GET_GLOBAL:
+			var v any
+			v, err = vm.global(env.globals, p.consts[in.a].(string), p.consts[in.b].(string))
+			stack = append(stack, v)
+		case OP_SET_GLOBAL:
+			env.globals.set(p.consts[in.a].(string), stack[len(stack)-1])
+			stack = stack[:len(stack)-1]
+		case OP_GET_IMPORTED:
+			var v any
+			v, err = vm.interp.resolveImported(p.consts[in.a].(string), env.globals)
+			stack = append(stack, v)
+		case OP_LIST:
+			list := make([]any, in.a)
+			copy(list, stack[len(stack)-in.a:])
+			stack = append(stack[:len(stack)-in.a], list)
+		case OP_HASH:
+			hash := map[string]any{}
+			base := len(stack) - 2*in.a
+			for idx := base; idx < len(stack); idx += 2 {
+				hash[stack[idx].(string)] = stack[idx+1]
+			}
+			stack = append(stack[:base], hash)
+		case OP_STREAM:
+			values := stack[len(stack)-in.a:]
+			base := len(stack) - in.a - in.b
+
+			size := in.a
+			if in.b == 1 {
+				n, cErr := streamCapacity(stack[base], in.a)
+				if cErr != nil {
+					err = cErr
+					break
+				}
+				size = n
+			}
+			stack = append(stack[:base], newStream(size, values))
+		case OP_CLOSURE:
+			stack = append(stack, vm.closure(p.protos[in.a], env))
+		case OP_THUNK:
+			te := env
+			if in.b == 1 {
+				te = env.branch()
+			}
+			stack = append(stack, vm.thunk(p.protos[in.a], te))
+		case OP_CHAIN:
+			descriptions := p.consts[in.b].([]string)
+			base := len(stack) - in.a
+			steps := []chainStep{}
+			for idx, t := range stack[base:] {
+				getter := t.(func() (any, error))
+				steps = append(steps, func() (any, error) {
+					v, err := getter()
+					if err != nil {
+						return nil, err
+					}
+
+					if !isFunc(v) {
+						return nil, newError("%s", descriptions[idx])
+					}
+					return v, nil
+				})
+			}
+			stack = append(stack[:base], newChain(steps))
+		case OP_ASYNC:
+			base := len(stack) - in.a
+			thunks := []func() (any, error){}
+			for _, t := range stack[base:] {
+				thunks = append(thunks, t.(func() (any, error)))
+			}
+			stack = append(stack[:base], spawnAsync(env.ctx, thunks, in.b == 1))
+		case OP_CALL:
+			base := len(stack) - in.a - 1
+			callee := stack[base]
+			args := make([]any, in.a)
+			copy(args, stack[base+1:])
+			stack = stack[:base]
+
+			if !isFunc(callee) {
+				err = newError("failed to cast function in call expression: %s is a %s", p.consts[in.c], describeType(callee))
+				break
+			}
+
+			var v any
+			v, err = callFunc(env.ctx, callee, args)
+			if err != nil {
+				err = asToyError(err).withFrame(p.consts[in.b].(string), in.pos)
+				break
+			}
+			stack = append(stack, v)
+		case OP_JUMP:
+			pc = in.a - 1
+		case OP_JUMP_IF_FALSE:
+			cond := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if cond == false {
+				pc = in.a - 1
+			}
+		case OP_JUMP_IF_EQ:
+			if stack[len(stack)-1] == (in.b == 1) {
+				pc = in.a - 1
+			}
+		case OP_ASSERT_BOOL:
+			if _, ok := stack[len(stack)-1].(bool); !ok {
+				err = newError("%s", p.consts[in.a])
+			}
+		case OP_MATCH_CASE:
+			cr := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			// a matcher expression producing true matches the value
+			if res, ok := cr.(bool); in.b == 0 && ok && res {
+				stack = append(stack, true)
+				break
+			}
+
+			var eq bool
+			eq, err = deepEqual(cr, env.slots[in.a])
+			if err != nil {
+				err = newError("@match: %s", err.Error())
+			}
+			stack = append(stack, eq)
+		case OP_SELECT:
+			targets := p.consts[in.c].([]int)
+			hasTimeout := in.b == 2
+			base := len(stack) - in.a
+			if hasTimeout {
+				base -= 1
+			}
+
+			var timeout any
+			if hasTimeout {
+				timeout = stack[len(stack)-1]
+			}
+			chosen, value, sErr := selectStream(env.ctx, stack[base:base+in.a], in.b == 1, timeout, hasTimeout)
+			stack = stack[:base]
+			if sErr != nil {
+				err = sErr
+				break
+			}
+
+			stack = append(stack, value)
+			switch chosen {
+			case SELECT_DEFAULT:
+				pc = targets[in.a] - 1
+			case SELECT_TIMEOUT:
+				pc = targets[in.a+1] - 1
+			case SELECT_CLOSED:
+				pc = targets[in.a+2] - 1
+			default:
+				pc = targets[chosen] - 1
+			}
+		case OP_TRY:
+			handlers = append(handlers, vmHandler{in.a, len(stack)})
+		case OP_END_TRY:
+			handlers = handlers[:len(handlers)-1]
+		case OP_IMPORT:
+			err = vm.interp.execImport(env.ctx, p.consts[in.a].(*ast.ImportStatement), env.globals)
+			stack = append(stack, nil)
+		case OP_EXPORT:
+			names := p.consts[in.b].([]string)
+			base := len(stack) - in.a
+			exports := newFrame(nil)
+			for idx, name := range names {
+				exports.set(name, stack[base+idx])
+			}
+			env.exports = exports
+			stack = append(stack[:base], nil)
+		case OP_RAISE:
+			err = newError("%s", p.consts[in.a])
+		}
+
+		if err != nil {
+			if len(handlers) == 0 {
+				return nil, err
+			}
+
+			h := handlers[len(handlers)-1]
+			handlers = handlers[:len(handlers)-1]
+			stack = append(stack[:h.height], caught(err))
+			pc = h.target - 1
+		}
+	}
+
+	return stack[len(stack)-1], nil
+}
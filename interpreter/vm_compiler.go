@@ -0,0 +1,492 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"toyscript/ast"
+	"toyscript/lexer"
+)
+
+// NOTE: the compiler resolves every declared ref at compile time.
+// Params and @var bindings of a function get a slot in its env,
+// refs to them become (depth, slot) pairs, where depth is the number of
+// enclosing funcs to go up. A ref keeps the pairs of every outer binding
+// of its name, a binding which isn't set yet falls back to the next one.
+// Bindings at the top level of a program are globals and,
+// like built-ins, are looked up by name.
+
+type (
+	opcode = byte
+
+	instr struct {
+		op      opcode
+		a, b, c int
+		pos     lexer.Position
+	}
+
+	// funcProto is the compiled code of a func, a program, or an inline
+	// block (@async branches and @chain steps) which runs in the env of its creator
+	funcProto struct {
+		name   string
+		params int
+		slots  int
+		code   []instr
+		consts []any
+		protos []*funcProto
+		span   lexer.Span
+	}
+
+	// vmScope maps the names bound in a block to slots,
+	// @match cases and @catch handlers open a new block in the same env
+	vmScope struct {
+		names    map[string]int
+		parent   *vmScope
+		env      *funcProto
+		boundary bool
+		global   bool
+	}
+
+	vmCompiler struct {
+		proto *funcProto
+		scope *vmScope
+	}
+)
+
+const (
+	OP_CONST opcode = iota
+	OP_NIL
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_IMPORTED
+	OP_LIST
+	OP_HASH
+	OP_STREAM
+	OP_CLOSURE
+	OP_THUNK
+	OP_CHAIN
+	OP_ASYNC
+	OP_CALL
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_JUMP_IF_EQ
+	OP_ASSERT_BOOL
+	OP_MATCH_CASE
+	OP_SELECT
+	OP_TRY
+	OP_END_TRY
+	OP_IMPORT
+	OP_EXPORT
+	OP_RAISE
+)
+
+// Compile translates a program into the bytecode of the VM
+func Compile(p *ast.ProgramStatement) *funcProto {
+	proto := &funcProto{name: "@program", span: p.Span}
+	c := &vmCompiler{proto, &vmScope{names: map[string]int{}, env: proto, boundary: true, global: true}}
+	c.block(p.Body)
+	return proto
+}
+
+func (c *vmCompiler) compile(n ast.Node) {
+	n.Accept(c)
+}
+
+// block compiles a list of expressions, leaving the value of the last one
+func (c *vmCompiler) block(body []ast.Node) {
+	if len(body) == 0 {
+		c.emit(OP_NIL, 0, 0, 0, lexer.Position{})
+		return
+	}
+
+	for idx, n := range body {
+		if idx > 0 {
+			c.emit(OP_POP, 0, 0, 0, lexer.Position{})
+		}
+		c.compile(n)
+	}
+}
+
+func (c *vmCompiler) emit(op opcode, a, b, x int, pos lexer.Position) int {
+	c.proto.code = append(c.proto.code, instr{op, a, b, x, pos})
+	return len(c.proto.code) - 1
+}
+
+func (c *vmCompiler) constant(v any) int {
+	c.proto.consts = append(c.proto.consts, v)
+	return len(c.proto.consts) - 1
+}
+
+// patch points the jump at idx to the next instruction
+func (c *vmCompiler) patch(idx int) {
+	c.proto.code[idx].a = len(c.proto.code)
+}
+
+func (c *vmCompiler) pushScope() {
+	c.scope = &vmScope{names: map[string]int{}, parent: c.scope, env: c.scope.env}
+}
+
+func (c *vmCompiler) popScope() {
+	c.scope = c.scope.parent
+}
+
+func (c *vmCompiler) declare(name string) int {
+	slot := c.scope.env.slots
+	c.scope.env.slots += 1
+	c.scope.names[name] = slot
+	return slot
+}
+
+// hoist declares the @var bindings of a block up front, so funcs
+// defined before a binding still see it, as they do in the tree-walker
+func (c *vmCompiler) hoist(nodes ...ast.Node) {
+	if c.scope.global {
+		return
+	}
+
+	for _, name := range ast.BlockBindings(nodes...) {
+		if _, ok := c.scope.names[name]; !ok {
+			c.declare(name)
+		}
+	}
+}
+
+// resolve returns the (depth, slot) pairs of every binding of name, innermost first
+func (c *vmCompiler) resolve(name string) []int {
+	pairs := []int{}
+	depth := 0
+	for s := c.scope; s != nil; s = s.parent {
+		if slot, ok := s.names[name]; ok {
+			pairs = append(pairs, depth, slot)
+		}
+		if s.boundary {
+			depth += 1
+		}
+	}
+
+	return pairs
+}
+
+// store binds the value on top of the stack to name in the current block
+func (c *vmCompiler) store(name string, pos lexer.Position) {
+	if c.scope.global {
+		c.emit(OP_SET_GLOBAL, c.constant(name), 0, 0, pos)
+		return
+	}
+
+	slot, ok := c.scope.names[name]
+	if !ok {
+		slot = c.declare(name)
+	}
+	c.emit(OP_SET_LOCAL, 0, slot, 0, pos)
+}
+
+// inline compiles n into a proto which shares the env and the scope of the current func
+func (c *vmCompiler) inline(name string, n ast.Node) int {
+	proto := &funcProto{name: name, span: n.Loc()}
+	inner := &vmCompiler{proto, c.scope}
+	inner.compile(n)
+
+	c.proto.protos = append(c.proto.protos, proto)
+	return len(c.proto.protos) - 1
+}
+
+func (c *vmCompiler) VisitString(n *ast.StringLiteral) any {
+	c.emit(OP_CONST, c.constant(n.Value), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitNumber(n *ast.NumberLiteral) any {
+	c.emit(OP_CONST, c.constant(n.Value), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitBoolean(n *ast.BooleanLiteral) any {
+	c.emit(OP_CONST, c.constant(n.Value), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitList(n *ast.ListLiteral) any {
+	for _, el := range n.Elements {
+		c.compile(el)
+	}
+	c.emit(OP_LIST, len(n.Elements), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitHash(n *ast.HashLiteral) any {
+	for _, el := range n.Elements {
+		c.emit(OP_CONST, c.constant(el.Key), 0, 0, n.Span.Start)
+		c.compile(el.Value)
+	}
+	c.emit(OP_HASH, len(n.Elements), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitStream(n *ast.StreamLiteral) any {
+	// NOTE: b is 1 when the capacity is on the stack below the values
+	hasCapacity := 0
+	if n.Capacity != nil {
+		c.compile(n.Capacity)
+		hasCapacity = 1
+	}
+	for _, el := range n.Values {
+		c.compile(el)
+	}
+	c.emit(OP_STREAM, len(n.Values), hasCapacity, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitFunc(n *ast.FuncLiteral) any {
+	proto := &funcProto{name: "@func", params: len(n.Params), span: n.Span}
+	inner := &vmCompiler{proto, &vmScope{names: map[string]int{}, parent: c.scope, env: proto, boundary: true}}
+	for _, p := range n.Params {
+		inner.declare(p)
+	}
+	inner.hoist(n.Body...)
+	inner.block(n.Body)
+
+	c.proto.protos = append(c.proto.protos, proto)
+	c.emit(OP_CLOSURE, len(c.proto.protos)-1, 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitProgram(n *ast.ProgramStatement) any {
+	c.block(n.Body)
+	return nil
+}
+
+func (c *vmCompiler) VisitVar(n *ast.VarStatement) any {
+	for _, b := range n.Vars {
+		c.compile(b.Value)
+		c.store(b.Name, n.Span.Start)
+	}
+	c.emit(OP_NIL, 0, 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitImport(n *ast.ImportStatement) any {
+	c.emit(OP_IMPORT, c.constant(n), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitExport(n *ast.ExportStatement) any {
+	names := []string{}
+	for _, e := range n.Exports {
+		c.compile(e)
+		names = append(names, e.(*ast.ReferenceExpression).RefName)
+	}
+	c.emit(OP_EXPORT, len(names), c.constant(names), 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitRef(n *ast.ReferenceExpression) any {
+	name := c.constant(n.RefName)
+	switch n.RefType {
+	case ast.REF_TYPE_IMPORTED:
+		c.emit(OP_GET_IMPORTED, name, 0, 0, n.Span.Start)
+	case ast.REF_TYPE_DECLARED:
+		if pairs := c.resolve(n.RefName); len(pairs) > 0 {
+			c.emit(OP_GET_LOCAL, c.constant(pairs), name, 0, n.Span.Start)
+			return nil
+		}
+		fallthrough
+	default:
+		c.emit(OP_GET_GLOBAL, name, c.constant(n.RefType), 0, n.Span.Start)
+	}
+	return nil
+}
+
+func (c *vmCompiler) VisitCall(n *ast.CallExpression) any {
+	c.compile(n.Callee)
+	for _, arg := range n.Args {
+		c.compile(arg)
+	}
+	c.emit(OP_CALL, len(n.Args), c.constant(ast.CalleeName(n.Callee)), c.constant(n.Callee.String()), n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitMatch(n *ast.MatchExpression) any {
+	c.compile(n.Cond)
+
+	c.pushScope()
+	defer c.popScope()
+
+	value := c.declare("value")
+	c.emit(OP_SET_LOCAL, 0, value, 0, n.Span.Start)
+	for _, mc := range n.Cases {
+		c.hoist(mc.When, mc.Then)
+	}
+
+	// NOTE: the first matching case wins
+	ends := []int{}
+	for _, mc := range n.Cases {
+		_, isLiteral := mc.When.(*ast.BooleanLiteral)
+		literal := 0
+		if isLiteral {
+			literal = 1
+		}
+
+		c.compile(mc.When)
+		c.emit(OP_MATCH_CASE, value, literal, 0, mc.When.Loc().Start)
+		next := c.emit(OP_JUMP_IF_FALSE, 0, 0, 0, mc.When.Loc().Start)
+		c.compile(mc.Then)
+		ends = append(ends, c.emit(OP_JUMP, 0, 0, 0, mc.Then.Loc().Start))
+		c.patch(next)
+	}
+
+	c.emit(OP_NIL, 0, 0, 0, n.Span.Start)
+	for _, end := range ends {
+		c.patch(end)
+	}
+	return nil
+}
+
+func (c *vmCompiler) VisitMalformed(n *ast.MalformedExpression) any {
+	c.emit(OP_RAISE, c.constant(fmt.Sprintf("failed to execute malformed expression: %s", n.Error)), 0, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitSeq(n *ast.SeqExpression) any {
+	c.block(n.Expressions)
+	return nil
+}
+
+func (c *vmCompiler) VisitChain(n *ast.ChainExpression) any {
+	descriptions := []string{}
+	for _, e := range n.Expressions {
+		switch e.(type) {
+		case *ast.FuncLiteral, *ast.ReferenceExpression:
+			c.emit(OP_THUNK, c.inline("@chain", e), 0, 0, e.Loc().Start)
+			descriptions = append(descriptions, fmt.Sprintf("expected func in chain: %s", e))
+		default:
+			// NOTE: fails when the chain is called, as in the tree-walker
+			proto := &funcProto{name: "@chain", span: e.Loc()}
+			proto.consts = []any{fmt.Sprintf("unexpected expression in chain: %s ", e)}
+			proto.code = []instr{{OP_RAISE, 0, 0, 0, e.Loc().Start}}
+			c.proto.protos = append(c.proto.protos, proto)
+			c.emit(OP_THUNK, len(c.proto.protos)-1, 0, 0, e.Loc().Start)
+			descriptions = append(descriptions, "")
+		}
+	}
+	c.emit(OP_CHAIN, len(n.Expressions), c.constant(descriptions), 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitAsync(n *ast.AsyncExpression) any {
+	for _, e := range n.Expressions {
+		// NOTE: b is 1 when the thunk runs in its own copy of the env,
+		// the bindings of a branch stay in its block
+		c.pushScope()
+		c.hoist(e)
+		c.emit(OP_THUNK, c.inline("@async", e), 1, 0, e.Loc().Start)
+		c.popScope()
+	}
+	// NOTE: b is 1 when the results are sent in order
+	ordered := 0
+	if n.Ordered {
+		ordered = 1
+	}
+	c.emit(OP_ASYNC, len(n.Expressions), ordered, 0, n.Span.Start)
+	return nil
+}
+
+func (c *vmCompiler) VisitLogical(n *ast.LogicalExpression) any {
+	// NOTE: (@and) is true and (@or) is false
+	stopAt := n.Operator == "@or"
+	stop := 0
+	if stopAt {
+		stop = 1
+	}
+
+	ends := []int{}
+	for _, o := range n.Operands {
+		c.compile(o)
+		msg := fmt.Sprintf("%s: expected a boolean operand, got %v", n.Operator, o)
+		c.emit(OP_ASSERT_BOOL, c.constant(msg), 0, 0, o.Loc().Start)
+		ends = append(ends, c.emit(OP_JUMP_IF_EQ, 0, stop, 0, o.Loc().Start))
+		c.emit(OP_POP, 0, 0, 0, o.Loc().Start)
+	}
+
+	c.emit(OP_CONST, c.constant(!stopAt), 0, 0, n.Span.Start)
+	for _, end := range ends {
+		c.patch(end)
+	}
+	return nil
+}
+
+func (c *vmCompiler) VisitSelect(n *ast.SelectExpression) any {
+	for _, sc := range n.Cases {
+		c.compile(sc.Stream)
+	}
+
+	// NOTE: b has 1 set for a default and 2 for a timeout, which is on top of the streams
+	clauses := 0
+	if n.Default != nil {
+		clauses = 1
+	}
+	if n.Timeout != nil {
+		c.compile(n.Timeout.After)
+		clauses = 2
+	}
+
+	// NOTE: the VM pushes the value and jumps to the target of the case,
+	// then the targets of the default, the timeout and of all streams being closed
+	targets := make([]int, len(n.Cases)+3)
+	c.emit(OP_SELECT, len(n.Cases), clauses, c.constant(targets), n.Span.Start)
+
+	ends := []int{}
+	branch := func(then ast.Node, bind bool) int {
+		target := len(c.proto.code)
+		c.pushScope()
+		if bind {
+			c.emit(OP_SET_LOCAL, 0, c.declare("value"), 0, then.Loc().Start)
+		} else {
+			c.emit(OP_POP, 0, 0, 0, then.Loc().Start)
+		}
+		c.hoist(then)
+		c.compile(then)
+		c.popScope()
+
+		ends = append(ends, c.emit(OP_JUMP, 0, 0, 0, then.Loc().Start))
+		return target
+	}
+
+	for idx, sc := range n.Cases {
+		targets[idx] = branch(sc.Then, true)
+	}
+	if n.Default != nil {
+		targets[len(n.Cases)] = branch(n.Default, false)
+	}
+	if n.Timeout != nil {
+		targets[len(n.Cases)+1] = branch(n.Timeout.Then, false)
+	}
+
+	// NOTE: the nil pushed for closed streams is the value of the select
+	targets[len(n.Cases)+2] = len(c.proto.code)
+	for _, end := range ends {
+		c.patch(end)
+	}
+	return nil
+}
+
+func (c *vmCompiler) VisitTry(n *ast.TryExpression) any {
+	handler := c.emit(OP_TRY, 0, 0, 0, n.Span.Start)
+	c.compile(n.Body)
+	c.emit(OP_END_TRY, 0, 0, 0, n.Span.Start)
+	end := c.emit(OP_JUMP, 0, 0, 0, n.Span.Start)
+
+	// NOTE: the VM pushes the error before jumping to the handler
+	c.patch(handler)
+	c.pushScope()
+	errSlot := c.declare(n.ErrName)
+	c.emit(OP_SET_LOCAL, 0, errSlot, 0, n.Handler.Loc().Start)
+	c.hoist(n.Handler)
+	c.compile(n.Handler)
+	c.popScope()
+
+	c.patch(end)
+	return nil
+}
@@ -0,0 +1,158 @@
+package interpreter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"toyscript/parser"
+)
+
+// runEngine runs src on a fresh engine and returns the formatted value or the error message
+func runEngine(t testing.TB, engine string, src string) (string, string) {
+	t.Helper()
+
+	program, err := parser.ParseSource("<test>", src)
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	e, err := NewEngine(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := e.Run(context.Background(), "", program)
+	if err != nil {
+		return "", err.Error()
+	}
+	return FormatValue(v), ""
+}
+
+func TestEnginesAgree(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		value string
+		err   string
+	}{
+		{"arithmetic", `(+ 1 (* 2 3.5) (/ 7 2) (% 7 3) (- 5))`, "7.5", ""},
+		{"comparisons", `(@list (< 1 2) (>= 2 3) (= (@list 1 2) (@list 1 2)) (!= "a" "b"))`, "(@list true false true true)", ""},
+		{"logical", `(@list (@and true (> 2 1)) (@or false false) (@not true))`, "(@list true false false)", ""},
+		{"var order", `(@var (a 1) (b (+ a 1))) (@list a b)`, "(@list 1 2)", ""},
+		{"recursion", `
+			(@var (fib (@func (n) ((@match (< n 2) (@when true n) (@when false (+ (fib (- n 1)) (fib (- n 2)))))))))
+			(fib 15)`, "610", ""},
+		{"closures", `
+			(@var (adder (@func (a) ((@func (b) ((+ a b)))))))
+			(@var (addTwo (adder 2)) (addTen (adder 10)))
+			(@list (addTwo 1) (addTen 5))`, "(@list 3 15)", ""},
+		{"match value", `(@match (+ 1 1) (@when 1 "one") (@when 2 (@list value "two")))`, `(@list 2 "two")`, ""},
+		{"hash", `
+			(@var (h (@hash ("a" 1) ("b" (@list 1 2)))))
+			(@set h "c" 3)
+			(@list (@get h "b") (@has h "c") (@len h))`, "(@list (@list 1 2) true 3)", ""},
+		{"map and filter", `
+			(@var (xs (@list 1 2 3 4)))
+			(@list (@map (@func (x) ((* x x))) xs) (@filter (@func (x) ((= (% x 2) 0))) xs))`,
+			"(@list (@list 1 4 9 16) (@list 2 4))", ""},
+		{"seq", `(@seq (@var (x 2)) (* x x))`, "4", ""},
+		{"chain", `
+			(@var (step (@chain (@func (x) ((+ x 1))) (@func (x) ((* x 10))))))
+			(step 1)`, "20", ""},
+		{"try catch", `(@try (/ 1 0) (@catch e (@get e "message")))`, `"/: division by zero"`, ""},
+		{"raise", `(@try (@error "boom") (@catch e (@get e "message")))`, `"boom"`, ""},
+		{"stream", `
+			(@var (s (@stream (@capacity 2) 1 2)))
+			(@close s)
+			(@collect s)`, "(@list 1 2)", ""},
+		{"ordered async", `(@collect (@async (@ordered) 1 (+ 1 1) 3))`, "(@list 1 2 3)", ""},
+		{"select", `
+			(@var (s (@stream (@capacity 1) 5)))
+			(@select (@when s (* value 2)) (@default 0))`, "10", ""},
+		{"outer binding before its shadow", `
+			(@var (outer (@func () (
+			  (@var (x "outer")
+			        (inner (@func () ((@var (before x) (x "inner")) (@list before x)))))
+			  (inner)))))
+			(outer)`, `(@list "outer" "inner")`, ""},
+		{"case binding before its shadow", `
+			(@var (m (@func (v) ((@match v (@when 1 (@seq (@var (got value) (value "shadow")) (@list got value))))))))
+			(m 1)`, `(@list 1 "shadow")`, ""},
+		{"async bindings of a func", `
+			(@var (run (@func () (
+			  (@var (x "before") (gate (@stream)))
+			  (@var (s (@async (@seq (@pull gate) x))))
+			  (@var (x "after"))
+			  (@push gate true)
+			  (@await s)))))
+			(run)`, `"before"`, ""},
+		{"async bindings of the globals", `
+			(@var (x "before") (gate (@stream)))
+			(@var (s (@async (@seq (@pull gate) x))))
+			(@var (x "after"))
+			(@push gate true)
+			(@list (@await s) x)`, `(@list "before" "after")`, ""},
+		{"division by zero", `(/ 1 0)`, "", "/: division by zero"},
+		{"undefined ref", `(+ x 1)`, "", "failed to resolve ref x (declared)"},
+		{"bad get", `(@get (@list 1) 3)`, "", "@get: index 3 out of range for list of length 1"},
+		{"bad condition", `(@and 1 true)`, "", "@and: expected a boolean operand, got 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			treeValue, treeErr := runEngine(t, ENGINE_TREE, tt.src)
+			vmValue, vmErr := runEngine(t, ENGINE_VM, tt.src)
+
+			if treeValue != vmValue || treeErr != vmErr {
+				t.Fatalf("engines disagree\ntree: %s %s\nvm:   %s %s", treeValue, treeErr, vmValue, vmErr)
+			}
+			if treeValue != tt.value {
+				t.Errorf("got %s, want %s", treeValue, tt.value)
+			}
+			if !strings.Contains(treeErr, tt.err) || (tt.err == "") != (treeErr == "") {
+				t.Errorf("got error %q, want one containing %q", treeErr, tt.err)
+			}
+		})
+	}
+}
+
+// BenchmarkEngines runs the scripts of examples/bench, like the bench command
+func BenchmarkEngines(b *testing.B) {
+	scripts, err := filepath.Glob("../examples/bench/*.toy")
+	if err != nil || len(scripts) == 0 {
+		b.Fatalf("no bench scripts: %v", err)
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+
+	for _, script := range scripts {
+		loaded, err := LoadScript(script)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(script), ".toy")
+		for _, engine := range []string{ENGINE_TREE, ENGINE_VM} {
+			b.Run(name+"/"+engine, func(b *testing.B) {
+				stdout := os.Stdout
+				os.Stdout = devNull
+				defer func() { os.Stdout = stdout }()
+
+				for range b.N {
+					e, _ := NewEngine(engine)
+					loaded.Preload(e)
+					if err := e.Exec(script, loaded.Program); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
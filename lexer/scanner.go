@@ -0,0 +1,381 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type (
+	TokenType = string
+	Token     struct {
+		Type    TokenType `json:"type"`
+		Lexeme  string    `json:"lexeme"`
+		Literal any       `json:"literal"`
+		Span    Span      `json:"span"`
+	}
+
+	// Position is a location in the source,
+	// Line and Column start at 1, Offset is the 0 based byte offset
+	Position struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+		Offset int `json:"offset"`
+	}
+
+	// Span is the source range [Start, End) of a token or a node
+	Span struct {
+		Start Position `json:"start"`
+		End   Position `json:"end"`
+	}
+
+	// Scanner turns source into tokens, comments included
+	Scanner struct {
+		source    string
+		tokens    []Token
+		start     Position
+		current   int
+		line      int
+		lineStart int
+	}
+)
+
+const (
+	TOKEN_LEFT_PAREN  TokenType = "open-paren"
+	TOKEN_RIGHT_PAREN TokenType = "close-paren"
+	TOKEN_COMMA       TokenType = "comma"
+	TOKEN_DOT         TokenType = "dot"
+	TOKEN_MINUS       TokenType = "minus"
+	TOKEN_PLUS        TokenType = "plus"
+	TOKEN_SLASH       TokenType = "slash"
+	TOKEN_STAR        TokenType = "star"
+	TOKEN_PERCENT     TokenType = "percent"
+	TOKEN_BANG        TokenType = "bang"
+	TOKEN_BANG_EQUAL  TokenType = "bang-equal"
+	TOKEN_EQUAL       TokenType = "equal"
+	TOKEN_LESS        TokenType = "less"
+	TOKEN_LESS_EQUAL  TokenType = "less-equal"
+	TOKEN_MORE        TokenType = "more"
+	TOKEN_MORE_EQUAL  TokenType = "more-equal"
+	TOKEN_HASH        TokenType = "hash"
+
+	TOKEN_BUILTIN    TokenType = "built-in"
+	TOKEN_IDENTIFIER TokenType = "identifier"
+	TOKEN_STRING     TokenType = "string"
+	TOKEN_NUMBER     TokenType = "number"
+	TOKEN_BOOLEAN    TokenType = "boolean"
+
+	TOKEN_COMMENT TokenType = "comment"
+
+	TOKEN_ERROR TokenType = "error"
+	TOKEN_EOF   TokenType = "end-of-file"
+	TOKEN_NULL  TokenType = "null-token"
+)
+
+func NewScanner(source string) *Scanner {
+	return &Scanner{source, []Token{}, Position{1, 1, 0}, 0, 1, 0}
+}
+
+func (s *Scanner) ScanTokens() ([]Token, error) {
+	for !s.done() {
+		s.start = s.position()
+		token := s.scanToken()
+		if token != nil {
+			s.tokens = append(s.tokens, *token)
+		}
+	}
+
+	s.start = s.position()
+	s.tokens = append(s.tokens, *s.token(TOKEN_EOF, "", nil))
+	return s.tokens, nil
+}
+
+func (s *Scanner) scanToken() *Token {
+	c := s.advance()
+	switch c {
+	case ' ', '\r', '\t':
+		return nil
+	case '\n':
+		return nil
+	case '(':
+		return s.token(TOKEN_LEFT_PAREN, "(", nil)
+	case ')':
+		return s.token(TOKEN_RIGHT_PAREN, ")", nil)
+	case ',':
+		return s.token(TOKEN_COMMA, ",", nil)
+	case '.':
+		return s.token(TOKEN_DOT, ".", nil)
+	case '-':
+		if isNumberic(s.peek()) {
+			return s.numberToken()
+		}
+		return s.token(TOKEN_MINUS, "-", nil)
+	case '+':
+		return s.token(TOKEN_PLUS, "+", nil)
+	case '*':
+		return s.token(TOKEN_STAR, "*", nil)
+	case '/':
+		return s.token(TOKEN_SLASH, "/", nil)
+	case '%':
+		return s.token(TOKEN_PERCENT, "%", nil)
+	case '!':
+		if s.peek() == '=' {
+			s.advance()
+			return s.token(TOKEN_BANG_EQUAL, "!=", nil)
+		}
+		return s.token(TOKEN_BANG, "!", nil)
+	case '=':
+		return s.token(TOKEN_EQUAL, "=", nil)
+	case '>':
+		if s.peek() == '=' {
+			s.advance()
+			return s.token(TOKEN_MORE_EQUAL, ">=", nil)
+		}
+		return s.token(TOKEN_MORE, ">", nil)
+	case '<':
+		if s.peek() == '=' {
+			s.advance()
+			return s.token(TOKEN_LESS_EQUAL, "<=", nil)
+		}
+		return s.token(TOKEN_LESS, "<", nil)
+	case '"':
+		return s.stringToken()
+	case '@':
+		return s.builtInToken()
+	case '#':
+		// NOTE: comments are kept for the formatter, the parser skips them
+		return s.commentToken()
+	default:
+		if isNumberic(c) {
+			return s.numberToken()
+		} else if s.match("true") {
+			return s.token(TOKEN_BOOLEAN, "true", true)
+		} else if s.match("false") {
+			return s.token(TOKEN_BOOLEAN, "false", false)
+		} else if isAlphabetic(c) {
+			return s.identifierToken()
+		}
+	}
+
+	size := 1
+	if c >= utf8.RuneSelf {
+		// NOTE: an unexpected non-ASCII char is a single token, not one per byte
+		_, size = utf8.DecodeRuneInString(s.source[s.current-1:])
+		s.current += size - 1
+	}
+
+	return s.token(TOKEN_ERROR, fmt.Sprintf("unexpected character '%s'", s.source[s.current-size:s.current]), nil)
+}
+
+func (s *Scanner) done() bool {
+	return s.current >= len(s.source)
+}
+
+func (s *Scanner) advance() byte {
+	char := s.source[s.current]
+	s.current += 1
+
+	if char == '\n' {
+		s.line += 1
+		s.lineStart = s.current
+	}
+
+	return char
+}
+
+func (s *Scanner) position() Position {
+	return Position{
+		Line:   s.line,
+		Column: s.current - s.lineStart + 1,
+		Offset: s.current,
+	}
+}
+
+// token creates a token spanning from the start of the current scan
+func (s *Scanner) token(t TokenType, lexeme string, literal any) *Token {
+	return &Token{t, lexeme, literal, Span{s.start, s.position()}}
+}
+
+func (s *Scanner) peek() byte {
+	if s.done() {
+		return byte(rune(0))
+	}
+
+	return s.source[s.current]
+}
+
+func (s *Scanner) peekNext() byte {
+	if s.current+1 >= len(s.source) {
+		return byte(rune(0))
+	}
+
+	return s.source[s.current+1]
+}
+
+// match checks if the current word, including the already consumed char, is expected
+func (s *Scanner) match(expected string) bool {
+	start := s.current - 1
+	if !strings.HasPrefix(s.source[start:], expected) {
+		return false
+	}
+
+	end := start + len(expected)
+	if end < len(s.source) && isAlphabetic(s.source[end]) {
+		// NOTE: a longer identifier such as true_story
+		return false
+	}
+
+	s.current = end
+	return true
+}
+
+func (s *Scanner) stringToken() *Token {
+	str := strings.Builder{}
+	for s.peek() != '"' && !s.done() {
+		str.WriteByte(s.advance())
+	}
+
+	if s.done() {
+		return s.token(TOKEN_ERROR, "Unterminated string", nil)
+	}
+
+	// consume the closing "
+	s.advance()
+
+	return s.token(TOKEN_STRING, str.String(), nil)
+}
+
+func (s *Scanner) commentToken() *Token {
+	str := strings.Builder{}
+	for s.peek() != '\n' && !s.done() {
+		str.WriteByte(s.advance())
+	}
+
+	return s.token(TOKEN_COMMENT, str.String(), nil)
+}
+
+func (s *Scanner) numberToken() *Token {
+	start := s.current - 1
+	isFloat := false
+
+	for isNumberic(s.peek()) {
+		s.advance()
+	}
+
+	// fractional part, the dot must be followed by a digit
+	if s.peek() == '.' && isNumberic(s.peekNext()) {
+		isFloat = true
+		s.advance()
+		for isNumberic(s.peek()) {
+			s.advance()
+		}
+	}
+
+	// exponent part: e10, e+10, e-10
+	if s.peek() == 'e' || s.peek() == 'E' {
+		next := s.peekNext()
+		if isNumberic(next) || ((next == '-' || next == '+') && s.current+2 < len(s.source) && isNumberic(s.source[s.current+2])) {
+			isFloat = true
+			s.advance()
+			if s.peek() == '-' || s.peek() == '+' {
+				s.advance()
+			}
+			for isNumberic(s.peek()) {
+				s.advance()
+			}
+		}
+	}
+
+	lexeme := s.source[start:s.current]
+	if isFloat {
+		f, err := strconv.ParseFloat(lexeme, 64)
+		if err != nil {
+			return s.token(TOKEN_ERROR, err.Error(), nil)
+		}
+
+		return s.token(TOKEN_NUMBER, lexeme, f)
+	}
+
+	i, err := strconv.Atoi(lexeme)
+	if err != nil {
+		return s.token(TOKEN_ERROR, err.Error(), nil)
+	}
+
+	return s.token(TOKEN_NUMBER, lexeme, i)
+}
+
+func (s *Scanner) identifierToken() *Token {
+	str := strings.Builder{}
+	str.WriteByte(s.source[s.current-1])
+
+	for isAlphabetic(s.peek()) {
+		if s.done() {
+			return s.token(TOKEN_ERROR, "unexpected end of input", nil)
+		}
+
+		str.WriteByte(s.advance())
+	}
+
+	return s.token(TOKEN_IDENTIFIER, str.String(), nil)
+}
+
+func (s *Scanner) builtInToken() *Token {
+	str := strings.Builder{}
+	str.WriteByte(s.source[s.current-1])
+
+	// NOTE: built-ins can be hyphenated, like @try-push
+	for isAlphabetic(s.peek()) || s.peek() == '-' && isAlphabetic(s.peekNext()) {
+		if s.done() {
+			return s.token(TOKEN_ERROR, "unexpected end of input", nil)
+		}
+
+		str.WriteByte(s.advance())
+	}
+
+	return s.token(TOKEN_BUILTIN, str.String(), nil)
+}
+
+// NOTE: bytes of multi-byte chars aren't letters or digits,
+// rune(b) would read them as Latin-1 chars
+
+func isNumberic(b byte) bool {
+	return b < utf8.RuneSelf && unicode.IsDigit(rune(b))
+}
+
+func isAlphabetic(b byte) bool {
+	return b < utf8.RuneSelf && unicode.IsLetter(rune(b)) || b == '_'
+}
+
+func (t Token) String() string {
+	switch t.Type {
+	case TOKEN_IDENTIFIER:
+		return ":" + t.Lexeme
+	case TOKEN_STRING:
+		return "'" + t.Lexeme + "'"
+	case TOKEN_NUMBER:
+		return t.Lexeme
+
+	}
+
+	return "@" + t.Type
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+func (s Span) String() string {
+	return s.Start.String() + "-" + s.End.String()
+}
+
+// Loc is promoted to every node that embeds a Span
+func (s Span) Loc() Span {
+	return s
+}
+
+// SetLoc replaces the span of the node embedding it
+func (s *Span) SetLoc(span Span) {
+	*s = span
+}
@@ -0,0 +1,82 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// describe renders the tokens as type:lexeme@line:column, without the end of file
+func describe(tokens []Token) string {
+	parts := []string{}
+	for _, t := range tokens {
+		if t.Type == TOKEN_EOF {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s@%s", t.Type, t.Lexeme, t.Span.Start))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func TestScanTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"call", `(add 1 2)`, "open-paren:(@1:1 identifier:add@1:2 number:1@1:6 number:2@1:8 close-paren:)@1:9"},
+		{"numbers", `3.14 -2 1e-6 2E3`, "number:3.14@1:1 number:-2@1:6 number:1e-6@1:9 number:2E3@1:14"},
+		{"operators", `+ - * / % = != ! < <= > >=`,
+			"plus:+@1:1 minus:-@1:3 star:*@1:5 slash:/@1:7 percent:%@1:9 equal:=@1:11 " +
+				"bang-equal:!=@1:13 bang:!@1:16 less:<@1:18 less-equal:<=@1:20 more:>@1:23 more-equal:>=@1:25"},
+		{"built-ins", `@var @try-push`, "built-in:@var@1:1 built-in:@try-push@1:6"},
+		{"booleans", `true false true_story`, "boolean:true@1:1 boolean:false@1:6 identifier:true_story@1:12"},
+		{"strings", `"a b" "é"`, `string:a b@1:1 string:é@1:7`},
+		{"imported refs", `stdio.print`, "identifier:stdio@1:1 dot:.@1:6 identifier:print@1:7"},
+		{"comments", "# first\n(x) # second", "comment: first@1:1 open-paren:(@2:1 identifier:x@2:2 close-paren:)@2:3 comment: second@2:5"},
+		{"lines", "(a\n  b)", "open-paren:(@1:1 identifier:a@1:2 identifier:b@2:3 close-paren:)@2:4"},
+		{"unexpected character", `(a ])`, "open-paren:(@1:1 identifier:a@1:2 error:unexpected character ']'@1:4 close-paren:)@1:5"},
+		{"unexpected non-ASCII", `(é)`, "open-paren:(@1:1 error:unexpected character 'é'@1:2 close-paren:)@1:4"},
+		{"unterminated string", `(a "b`, "open-paren:(@1:1 identifier:a@1:2 error:Unterminated string@1:4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := NewScanner(tt.source).ScanTokens()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(tokens); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenLiterals(t *testing.T) {
+	tokens, _ := NewScanner(`1 2.5 -3 1e2 true`).ScanTokens()
+	want := []any{1, 2.5, -3, 100.0, true}
+
+	for idx, w := range want {
+		if tokens[idx].Literal != w {
+			t.Errorf("%s: got %#v, want %#v", tokens[idx].Lexeme, tokens[idx].Literal, w)
+		}
+	}
+}
+
+func TestTokenSpans(t *testing.T) {
+	tokens, _ := NewScanner("(@var\n  (name \"é\"))").ScanTokens()
+
+	want := []string{"1:1-1:2", "1:2-1:6", "2:3-2:4", "2:4-2:8", "2:9-2:13", "2:13-2:14", "2:14-2:15", "2:15-2:15"}
+	for idx, w := range want {
+		if got := tokens[idx].Span.String(); got != w {
+			t.Errorf("%s %q: got %s, want %s", tokens[idx].Type, tokens[idx].Lexeme, got, w)
+		}
+	}
+
+	// NOTE: offsets are in bytes, the é is two
+	if end := tokens[len(tokens)-1].Span.End.Offset; end != 20 {
+		t.Errorf("got the end of file at %d, want 20", end)
+	}
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"toyscript/lexer"
+)
+
+type (
+	// Diagnostic is a single problem found in a script
+	Diagnostic struct {
+		Message  string
+		Span     lexer.Span
+		Expected lexer.TokenType
+		Found    lexer.TokenType
+	}
+
+	// SyntaxError is returned for a script that failed to parse,
+	// its message is the formatted report of the diagnostics
+	SyntaxError struct {
+		Filename    string
+		Diagnostics []Diagnostic
+		report      string
+	}
+)
+
+func (e *SyntaxError) Error() string {
+	return e.report
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Span.Start, d.Describe())
+}
+
+// Describe is the message with the expected and found tokens, without the position
+func (d Diagnostic) Describe() string {
+	if d.Expected != "" && d.Found != "" {
+		return d.Message + fmt.Sprintf(" (expected %s, found %s)", d.Expected, d.Found)
+	}
+
+	return d.Message
+}
+
+// FormatDiagnostic renders d compiler-style, with the offending
+// source line and a caret under the reported span
+//
+//	script.toy:3:5: error: expected ) in call expression
+//	   3 | (test (a)
+//	     |     ^
+func FormatDiagnostic(filename string, source string, d Diagnostic) string {
+	str := strings.Builder{}
+	str.WriteString(fmt.Sprintf("%s:%s: error: %s\n", filename, d.Span.Start, d.Describe()))
+
+	lines := strings.Split(source, "\n")
+	lineIdx := d.Span.Start.Line - 1
+	if lineIdx < 0 || lineIdx >= len(lines) {
+		return str.String()
+	}
+
+	line := strings.TrimRight(lines[lineIdx], "\r")
+	gutter := fmt.Sprintf("%4d | ", d.Span.Start.Line)
+	str.WriteString(gutter + line + "\n")
+
+	col := max(d.Span.Start.Column-1, 0)
+	width := 1
+	if d.Span.End.Line == d.Span.Start.Line && d.Span.End.Column > d.Span.Start.Column {
+		width = d.Span.End.Column - d.Span.Start.Column
+	}
+
+	// NOTE: keep tabs so the caret lines up with the source
+	padding := strings.Builder{}
+	for idx := 0; idx < col && idx < len(line); idx += 1 {
+		if line[idx] == '\t' {
+			padding.WriteByte('\t')
+		} else {
+			padding.WriteByte(' ')
+		}
+	}
+
+	str.WriteString(strings.Repeat(" ", len(gutter)-2) + "| " + padding.String() + strings.Repeat("^", width) + "\n")
+
+	return str.String()
+}
+
+// FormatDiagnostics renders all syntax errors followed by a summary line
+func FormatDiagnostics(filename string, source string, diagnostics []Diagnostic) string {
+	return FormatReport(filename, source, diagnostics, "syntax error")
+}
+
+// FormatReport renders the diagnostics followed by a summary line counting them as kind
+func FormatReport(filename string, source string, diagnostics []Diagnostic, kind string) string {
+	str := strings.Builder{}
+	for _, d := range diagnostics {
+		str.WriteString(FormatDiagnostic(filename, source, d))
+	}
+
+	plural := "s"
+	if len(diagnostics) == 1 {
+		plural = ""
+	}
+	str.WriteString(fmt.Sprintf("%d %s%s", len(diagnostics), kind, plural))
+
+	return str.String()
+}
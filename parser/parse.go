@@ -0,0 +1,39 @@
+package parser
+
+import (
+	"toyscript/ast"
+	"toyscript/lexer"
+)
+
+// ParseSource scans and parses a whole script,
+// syntax errors are returned as a *SyntaxError formatted with source excerpts
+func ParseSource(filename string, source string) (*ast.ProgramStatement, error) {
+	return parseSource(filename, source, false)
+}
+
+// ParseInput is ParseSource for the REPL, a literal or a ref
+// at the top level is an expression, so its value can be printed
+func ParseInput(filename string, source string) (*ast.ProgramStatement, error) {
+	return parseSource(filename, source, true)
+}
+
+func parseSource(filename string, source string, atoms bool) (*ast.ProgramStatement, error) {
+	tokens, err := lexer.NewScanner(source).ScanTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewParser(tokens)
+	p.atoms = atoms
+
+	program, diagnostics := p.Parse()
+	if len(diagnostics) > 0 {
+		return nil, &SyntaxError{
+			Filename:    filename,
+			Diagnostics: diagnostics,
+			report:      FormatDiagnostics(filename, source, diagnostics),
+		}
+	}
+
+	return &program, nil
+}
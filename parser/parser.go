@@ -0,0 +1,915 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"toyscript/ast"
+	"toyscript/lexer"
+)
+
+type (
+	// Parser builds the AST of a script from its tokens, recovering from malformed forms
+	Parser struct {
+		tokens      []lexer.Token
+		_current    int
+		diagnostics []Diagnostic
+		// atoms accepts literals and refs at the top level, as typed in the REPL
+		atoms bool
+	}
+)
+
+func NewParser(tokens []lexer.Token) *Parser {
+	code := []lexer.Token{}
+	for _, t := range tokens {
+		if t.Type != lexer.TOKEN_COMMENT {
+			code = append(code, t)
+		}
+	}
+
+	return &Parser{code, 0, []Diagnostic{}, false}
+}
+
+// Parse parses the whole program, recovering after every malformed form,
+// so all syntax errors are reported in a single pass
+func (p *Parser) Parse() (ast.ProgramStatement, []Diagnostic) {
+	program, _ := p.programStatement()
+	return program, p.diagnostics
+}
+
+func (p *Parser) programStatement() (ast.ProgramStatement, bool) {
+	program := ast.ProgramStatement{
+		Body: []ast.Node{},
+	}
+
+	hasErrors := false
+	for !p.done() {
+		child, hasError := p.statement()
+		if hasError {
+			hasErrors = true
+		}
+
+		if child != nil {
+			program.Body = append(program.Body, child)
+		}
+	}
+
+	if len(p.tokens) > 0 {
+		program.Span = lexer.Span{Start: p.tokens[0].Span.Start, End: p.tokens[len(p.tokens)-1].Span.End}
+	}
+
+	return program, hasErrors
+}
+
+func (p *Parser) statement() (ast.Node, bool) {
+	if p.match(lexer.TOKEN_LEFT_PAREN) {
+		openIdx := p._current - 1
+		if p.check(lexer.TOKEN_BUILTIN) {
+			t := p.advance()
+			switch t.Lexeme {
+			case "@import":
+				n, hasErr := p.importStatement()
+				return p.recover(n, openIdx, hasErr), hasErr
+			case "@export":
+				n, hasErr := p.exportStatement()
+				return p.recover(n, openIdx, hasErr), hasErr
+			default:
+				p.revert()
+				p.revert()
+				return p.expression()
+			}
+		} else {
+			p.revert()
+			return p.expression()
+		}
+	}
+
+	// NOTE: a ) is never an expression, expression() would leave it in place
+	if p.atoms && !p.check(lexer.TOKEN_RIGHT_PAREN) {
+		return p.expression()
+	}
+
+	failingAt := p.advance()
+	return p.malformed(failingAt, fmt.Errorf("unexpected %s in statement", describeToken(failingAt))), true
+}
+
+func (p *Parser) expression() (ast.Node, bool) {
+	if p.match(lexer.TOKEN_LEFT_PAREN) {
+		openIdx := p._current - 1
+		n, hasErr := p.form()
+		return p.recover(n, openIdx, hasErr), hasErr
+	}
+
+	return p.simpleLiteral()
+}
+
+// form parses a parenthesised expression, the ( is already consumed
+func (p *Parser) form() (ast.Node, bool) {
+	t := p.advance()
+	switch t.Type {
+	case lexer.TOKEN_BUILTIN:
+		switch t.Lexeme {
+		case "@var":
+			return p.varStatement()
+		case "@list":
+			return p.listLiteral()
+		case "@hash":
+			return p.hashLiteral()
+		case "@match":
+			return p.matchExpression()
+		case "@func":
+			return p.funcExpression()
+		case "@seq":
+			return p.seqExpression()
+		case "@chain":
+			return p.chainExpression()
+		case "@async":
+			return p.asyncExpression()
+		case "@and", "@or":
+			return p.logicalExpression(t.Lexeme)
+		case "@try":
+			return p.tryExpression()
+		case "@stream":
+			return p.streamLiteral()
+		case "@select":
+			return p.selectExpression()
+		default:
+			p.revert()
+			return p.callExpression()
+		}
+	case lexer.TOKEN_IDENTIFIER, lexer.TOKEN_EQUAL, lexer.TOKEN_BANG_EQUAL, lexer.TOKEN_BANG,
+		lexer.TOKEN_LESS, lexer.TOKEN_LESS_EQUAL, lexer.TOKEN_MORE, lexer.TOKEN_MORE_EQUAL,
+		lexer.TOKEN_PLUS, lexer.TOKEN_MINUS, lexer.TOKEN_STAR, lexer.TOKEN_SLASH, lexer.TOKEN_PERCENT:
+		p.revert()
+		return p.callExpression()
+	default:
+		return p.malformed(t, fmt.Errorf("unexpected %s at the start of a form", describeToken(t))), true
+	}
+}
+
+func (p *Parser) simpleLiteral() (ast.Node, bool) {
+	t := p.advance()
+	switch t.Type {
+	case lexer.TOKEN_STRING:
+		return &ast.StringLiteral{Span: t.Span, Value: t.Lexeme}, false
+	case lexer.TOKEN_NUMBER:
+		switch t.Literal.(type) {
+		case int, float64:
+			return &ast.NumberLiteral{Span: t.Span, Value: t.Literal}, false
+		}
+		return p.malformed(t, fmt.Errorf("malformed number literal")), true
+	case lexer.TOKEN_BOOLEAN:
+		return &ast.BooleanLiteral{Span: t.Span, Value: t.Literal.(bool)}, false
+	case lexer.TOKEN_IDENTIFIER:
+		p.revert()
+		return p.referenceExpression()
+	}
+
+	// NOTE: a ) is left to close the enclosing form
+	if t.Type == lexer.TOKEN_RIGHT_PAREN {
+		p.revert()
+	}
+
+	return p.malformed(t, fmt.Errorf("unexpected %s in expression", describeToken(t))), true
+}
+
+// describeToken names a token in a message by its source text
+func describeToken(t lexer.Token) string {
+	switch t.Type {
+	case lexer.TOKEN_EOF:
+		return "end of input"
+	case lexer.TOKEN_STRING:
+		return strconv.Quote(t.Lexeme)
+	}
+
+	return "'" + t.Lexeme + "'"
+}
+
+// STATEMENTS
+
+func (p *Parser) importStatement() (ast.Node, bool) {
+	imports := map[string]string{}
+	aliasSpans := map[string]lexer.Span{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		_, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected import pair")
+		if err != nil {
+			return err, true
+		}
+
+		alias, err := p.consume(lexer.TOKEN_IDENTIFIER, "expected module alias")
+		if err != nil {
+			return err, true
+		}
+
+		path, err := p.consume(lexer.TOKEN_STRING, "expected module path")
+		if err != nil {
+			return err, true
+		}
+
+		_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "malformed import pair: missing closing )")
+		if err != nil {
+			return err, true
+		}
+
+		_, alreadyExists := imports[alias.Lexeme]
+		if alreadyExists {
+			return p.malformed(alias, fmt.Errorf("duplicated import alias")), true
+		}
+		imports[alias.Lexeme] = path.Lexeme
+		aliasSpans[alias.Lexeme] = alias.Span
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected closing ) for import statement")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.ImportStatement{Imports: imports, AliasSpans: aliasSpans}, false
+}
+
+func (p *Parser) varStatement() (ast.Node, bool) {
+	vars := []ast.VarBinding{}
+	seen := map[string]bool{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		open, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected variable pair")
+		if err != nil {
+			return err, true
+		}
+
+		name, err := p.consume(lexer.TOKEN_IDENTIFIER, "expected variable name")
+		if err != nil {
+			return err, true
+		}
+
+		value, hasErr := p.expression()
+		if hasErr {
+			return value, true
+		}
+
+		closing, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "malformed variable pair: missing closing )")
+		if err != nil {
+			return err, true
+		}
+
+		if seen[name.Lexeme] {
+			return p.malformed(name, fmt.Errorf("duplicated variable name")), true
+		}
+		seen[name.Lexeme] = true
+		vars = append(vars, ast.VarBinding{
+			Span:     lexer.Span{Start: open.Span.Start, End: closing.Span.End},
+			Name:     name.Lexeme,
+			NameSpan: name.Span,
+			Value:    value,
+		})
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected closing ) for var statement")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.VarStatement{Vars: vars}, false
+}
+
+func (p *Parser) exportStatement() (ast.Node, bool) {
+	exports := []ast.Node{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		if p.check(lexer.TOKEN_IDENTIFIER) {
+			// NOTE: variable export
+			t := p.advance()
+			exports = append(exports, &ast.ReferenceExpression{Span: t.Span, RefName: t.Lexeme, RefType: ast.REF_TYPE_DECLARED})
+		} else {
+			return p.malformed(p.peek(0), fmt.Errorf("unexpected token in exports list")), true
+		}
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected closing ) for export statement")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.ExportStatement{Exports: exports}, false
+}
+
+// EXPRESSIONS
+
+func (p *Parser) callExpression() (ast.Node, bool) {
+	hasErrors := false
+	callee, hasErr := p.referenceExpression()
+	if hasErr {
+		hasErrors = true
+	}
+
+	args := []ast.Node{}
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		arg, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		args = append(args, arg)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected ) in call expression")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.CallExpression{
+		Callee: callee,
+		Args:   args,
+	}, hasErrors
+}
+
+func (p *Parser) funcExpression() (ast.Node, bool) {
+	_, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected params list for func declaration")
+	if err != nil {
+		return err, true
+	}
+
+	hasErrors := false
+	params, paramSpans := []string{}, []lexer.Span{}
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		param, err := p.consume(lexer.TOKEN_IDENTIFIER, "expected param name")
+		if err != nil {
+			hasErrors = true
+		}
+
+		params = append(params, param.Lexeme)
+		paramSpans = append(paramSpans, param.Span)
+	}
+
+	_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected ) at the end of params list")
+	if err != nil {
+		return err, true
+	}
+
+	_, err = p.consume(lexer.TOKEN_LEFT_PAREN, "expected body for func declaration")
+	if err != nil {
+		return err, true
+	}
+
+	body := []ast.Node{}
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		child, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+		body = append(body, child)
+	}
+
+	_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected ) at the end of func body")
+	if err != nil {
+		return err, true
+	}
+
+	_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of func declaration")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.FuncLiteral{Params: params, ParamSpans: paramSpans, Body: body}, hasErrors
+}
+
+func (p *Parser) referenceExpression() (ast.Node, bool) {
+	part1 := p.advance()
+	switch part1.Type {
+	case lexer.TOKEN_EQUAL, lexer.TOKEN_BANG_EQUAL, lexer.TOKEN_BANG,
+		lexer.TOKEN_LESS, lexer.TOKEN_LESS_EQUAL, lexer.TOKEN_MORE, lexer.TOKEN_MORE_EQUAL,
+		lexer.TOKEN_PLUS, lexer.TOKEN_MINUS, lexer.TOKEN_STAR, lexer.TOKEN_SLASH, lexer.TOKEN_PERCENT:
+		return &ast.ReferenceExpression{Span: part1.Span, RefName: part1.Lexeme, RefType: ast.REF_TYPE_BUILTIN}, false
+	case lexer.TOKEN_BUILTIN:
+		return &ast.ReferenceExpression{Span: part1.Span, RefName: part1.Lexeme, RefType: ast.REF_TYPE_BUILTIN}, false
+	case lexer.TOKEN_IDENTIFIER:
+		if p.match(lexer.TOKEN_DOT) {
+			part2, err := p.consume(lexer.TOKEN_IDENTIFIER, "malformed reference to imported value")
+			if err != nil {
+				return err, true
+			}
+
+			return &ast.ReferenceExpression{
+				Span:    lexer.Span{Start: part1.Span.Start, End: part2.Span.End},
+				RefName: part1.Lexeme + "." + part2.Lexeme,
+				RefType: ast.REF_TYPE_IMPORTED,
+			}, false
+		}
+
+		return &ast.ReferenceExpression{Span: part1.Span, RefName: part1.Lexeme, RefType: ast.REF_TYPE_DECLARED}, false
+	}
+
+	return p.malformed(part1, fmt.Errorf("unexpected token in reference")), true
+}
+
+func (p *Parser) matchExpression() (ast.Node, bool) {
+	hasErrors := false
+	cases := []ast.MatchCase{}
+
+	cond, hasErr := p.expression()
+	if hasErr {
+		hasErrors = true
+	}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		_, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected start of when expression")
+		if err != nil {
+			return err, true
+		}
+
+		when, err := p.consume(lexer.TOKEN_BUILTIN, "expected when key word")
+		if err != nil {
+			return err, true
+		}
+		if when.Lexeme != "@when" {
+			return p.malformed(when, fmt.Errorf("expected @when, got %s", when.Lexeme)), true
+		}
+
+		expected, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		action, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of when expression")
+		if err != nil {
+			return err, true
+		}
+
+		cases = append(cases, ast.MatchCase{When: expected, Then: action})
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of match expression")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.MatchExpression{Cond: cond, Cases: cases}, hasErrors
+}
+
+func (p *Parser) seqExpression() (ast.Node, bool) {
+	hasErrors := false
+	exprs := []ast.Node{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		e, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		exprs = append(exprs, e)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of seq")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.SeqExpression{Expressions: exprs}, hasErrors
+}
+
+func (p *Parser) chainExpression() (ast.Node, bool) {
+	hasErrors := false
+
+	exprs := []ast.Node{}
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		e, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		exprs = append(exprs, e)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of chain")
+	if err != nil {
+		return err, true
+	}
+
+	if len(exprs) == 0 {
+		return p.malformed(nil, fmt.Errorf("chain expects at least one inner expression")), true
+	}
+
+	return &ast.ChainExpression{Expressions: exprs}, hasErrors
+}
+
+func (p *Parser) asyncExpression() (ast.Node, bool) {
+	hasErrors := false
+	exprs := []ast.Node{}
+
+	// NOTE: an optional (@ordered) comes before the expressions
+	ordered := p.check(lexer.TOKEN_LEFT_PAREN) && p.peek(1).Lexeme == "@ordered"
+	if ordered {
+		p.advance()
+		p.advance()
+
+		_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of ordered clause")
+		if err != nil {
+			return err, true
+		}
+	}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		e, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		exprs = append(exprs, e)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of async")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.AsyncExpression{Ordered: ordered, Expressions: exprs}, hasErrors
+}
+
+func (p *Parser) logicalExpression(operator string) (ast.Node, bool) {
+	hasErrors := false
+	operands := []ast.Node{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		e, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		operands = append(operands, e)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of "+operator)
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.LogicalExpression{Operator: operator, Operands: operands}, hasErrors
+}
+
+func (p *Parser) tryExpression() (ast.Node, bool) {
+	hasErrors := false
+
+	body, hasErr := p.expression()
+	if hasErr {
+		hasErrors = true
+	}
+
+	_, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected catch clause in try expression")
+	if err != nil {
+		return err, true
+	}
+
+	catch, err := p.consume(lexer.TOKEN_BUILTIN, "expected catch key word")
+	if err != nil {
+		return err, true
+	}
+	if catch.Lexeme != "@catch" {
+		return p.malformed(catch, fmt.Errorf("expected @catch, got %s", catch.Lexeme)), true
+	}
+
+	errName, err := p.consume(lexer.TOKEN_IDENTIFIER, "expected error name in catch clause")
+	if err != nil {
+		return err, true
+	}
+
+	handler, hasErr := p.expression()
+	if hasErr {
+		hasErrors = true
+	}
+
+	_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of catch clause")
+	if err != nil {
+		return err, true
+	}
+
+	_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of try expression")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.TryExpression{Body: body, ErrName: errName.Lexeme, ErrSpan: errName.Span, Handler: handler}, hasErrors
+}
+
+func (p *Parser) selectExpression() (ast.Node, bool) {
+	hasErrors := false
+	sel := &ast.SelectExpression{Cases: []ast.SelectCase{}}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		_, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected start of select clause")
+		if err != nil {
+			return err, true
+		}
+
+		clause, err := p.consume(lexer.TOKEN_BUILTIN, "expected @when, @default or @timeout")
+		if err != nil {
+			return err, true
+		}
+
+		switch clause.Lexeme {
+		case "@when":
+			stream, hasErr := p.expression()
+			if hasErr {
+				hasErrors = true
+			}
+
+			then, hasErr := p.expression()
+			if hasErr {
+				hasErrors = true
+			}
+
+			sel.Cases = append(sel.Cases, ast.SelectCase{Stream: stream, Then: then})
+		case "@default":
+			if sel.Default != nil || sel.Timeout != nil {
+				return p.malformed(clause, fmt.Errorf("select expression can only have one @default or @timeout")), true
+			}
+
+			then, hasErr := p.expression()
+			if hasErr {
+				hasErrors = true
+			}
+
+			sel.Default = then
+		case "@timeout":
+			if sel.Default != nil || sel.Timeout != nil {
+				return p.malformed(clause, fmt.Errorf("select expression can only have one @default or @timeout")), true
+			}
+
+			after, hasErr := p.expression()
+			if hasErr {
+				hasErrors = true
+			}
+
+			then, hasErr := p.expression()
+			if hasErr {
+				hasErrors = true
+			}
+
+			sel.Timeout = &ast.SelectTimeout{After: after, Then: then}
+		default:
+			return p.malformed(clause, fmt.Errorf("expected @when, @default or @timeout, got %s", clause.Lexeme)), true
+		}
+
+		_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of select clause")
+		if err != nil {
+			return err, true
+		}
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of select expression")
+	if err != nil {
+		return err, true
+	}
+
+	return sel, hasErrors
+}
+
+// LITERALS
+
+func (p *Parser) listLiteral() (ast.Node, bool) {
+	hasErrors := false
+	elements := []ast.Node{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		el, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+		elements = append(elements, el)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected ) at end of list")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.ListLiteral{Elements: elements}, hasErrors
+}
+
+func (p *Parser) streamLiteral() (ast.Node, bool) {
+	hasErrors := false
+	stream := &ast.StreamLiteral{Values: []ast.Node{}}
+
+	// NOTE: an optional (@capacity n) comes before the values
+	if p.check(lexer.TOKEN_LEFT_PAREN) && p.peek(1).Lexeme == "@capacity" {
+		p.advance()
+		p.advance()
+
+		capacity, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+		stream.Capacity = capacity
+
+		_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of capacity clause")
+		if err != nil {
+			return err, true
+		}
+	}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		el, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+		stream.Values = append(stream.Values, el)
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected ) at end of stream")
+	if err != nil {
+		return err, true
+	}
+
+	return stream, hasErrors
+}
+
+func (p *Parser) hashLiteral() (ast.Node, bool) {
+	hasErrors := false
+	store := []ast.HashEntry{}
+	seen := map[string]bool{}
+
+	for !p.check(lexer.TOKEN_RIGHT_PAREN) && !p.done() {
+		// NOTE: consume pairs
+		_, err := p.consume(lexer.TOKEN_LEFT_PAREN, "expected key value pair")
+		if err != nil {
+			return err, true
+		}
+
+		// SHIT: this means keys cannot be dymanic!
+		key, err := p.consume(lexer.TOKEN_STRING, "key must be a string")
+		if err != nil {
+			return err, true
+		}
+
+		value, hasErr := p.expression()
+		if hasErr {
+			hasErrors = true
+		}
+
+		if seen[key.Lexeme] {
+			p.malformed(key, fmt.Errorf("duplicated hash key %s", key.Lexeme))
+			hasErrors = true
+		}
+
+		_, err = p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of key value pair")
+		if err != nil {
+			return err, true
+		}
+
+		seen[key.Lexeme] = true
+		store = append(store, ast.HashEntry{Key: key.Lexeme, Value: value})
+	}
+
+	_, err := p.consume(lexer.TOKEN_RIGHT_PAREN, "expected end of hash literal")
+	if err != nil {
+		return err, true
+	}
+
+	return &ast.HashLiteral{Elements: store}, hasErrors
+}
+
+// PARSER HELPERS
+
+func (p *Parser) done() bool {
+	return p._current >= len(p.tokens) || p.tokens[p._current].Type == lexer.TOKEN_EOF
+}
+
+func (p *Parser) peek(i int) lexer.Token {
+	index := p._current + i
+	if index >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+
+	return p.tokens[index]
+}
+
+func (p *Parser) advance() lexer.Token {
+	t := p.peek(0)
+
+	p._current += 1
+
+	return t
+}
+
+func (p *Parser) match(_type lexer.TokenType) bool {
+	if p.check(_type) {
+		p.advance()
+		return true
+	}
+
+	return false
+}
+
+func (p *Parser) check(_type lexer.TokenType) bool {
+	if p.done() {
+		return false
+	}
+
+	return p.peek(0).Type == _type
+}
+
+func (p *Parser) consume(_type lexer.TokenType, err string) (lexer.Token, *ast.MalformedExpression) {
+	t := p.advance()
+	if t.Type == _type {
+		return t, nil
+	}
+
+	m := p.malformed(t, fmt.Errorf("%s", err))
+	if t.Type != lexer.TOKEN_ERROR {
+		p.diagnostics[len(p.diagnostics)-1].Expected = _type
+	}
+
+	return lexer.Token{}, m
+}
+
+// malformed creates a malformed node and records a diagnostic for it
+func (p *Parser) malformed(body ast.Value, err error) *ast.MalformedExpression {
+	m := &ast.MalformedExpression{Body: body, Error: err}
+	d := Diagnostic{Message: err.Error()}
+
+	switch b := body.(type) {
+	case lexer.Token:
+		m.Span = b.Span
+		d.Found = b.Type
+		if b.Type == lexer.TOKEN_ERROR {
+			// NOTE: scanner errors carry their message as the lexeme
+			d.Message = b.Lexeme
+			m.Error = errors.New(b.Lexeme)
+		}
+	case ast.Node:
+		m.Span = b.Loc()
+	}
+
+	if m.Span == (lexer.Span{}) {
+		m.Span = p.peek(0).Span
+	}
+	d.Span = m.Span
+	// NOTE: recovering may reach the token that failed again
+	if n := len(p.diagnostics); n > 0 && p.diagnostics[n-1].Span == d.Span {
+		return m
+	}
+	p.diagnostics = append(p.diagnostics, d)
+
+	return m
+}
+
+// recover spans the form opened at openIdx and, if it failed to parse,
+// skips to the ) matching its ( so the following forms can still be parsed
+func (p *Parser) recover(n ast.Node, openIdx int, hasErr bool) ast.Node {
+	if hasErr {
+		p.synchronize(openIdx)
+	}
+
+	return p.spanned(n, p.tokens[openIdx])
+}
+
+func (p *Parser) synchronize(openIdx int) {
+	depth := 0
+	for idx := openIdx; idx < len(p.tokens); idx += 1 {
+		switch p.tokens[idx].Type {
+		case lexer.TOKEN_LEFT_PAREN:
+			depth += 1
+		case lexer.TOKEN_RIGHT_PAREN:
+			depth -= 1
+			if depth == 0 {
+				p._current = idx + 1
+				return
+			}
+		case lexer.TOKEN_EOF:
+			p._current = idx
+			return
+		}
+	}
+
+	p._current = len(p.tokens)
+}
+
+// spanned sets the span of a parenthesised node from its opening to its closing token
+func (p *Parser) spanned(n ast.Node, open lexer.Token) ast.Node {
+	span := lexer.Span{Start: open.Span.Start, End: p.peek(-1).Span.End}
+	if m, isMalformed := n.(*ast.MalformedExpression); isMalformed && m.Span != (lexer.Span{}) {
+		// NOTE: keep pointing at the exact token that failed
+		return n
+	}
+
+	if s, ok := n.(interface{ SetLoc(lexer.Span) }); ok {
+		s.SetLoc(span)
+	}
+
+	return n
+}
+
+func (p *Parser) revert() lexer.Token {
+	if p._current-1 < 0 {
+		return p.tokens[0]
+	}
+
+	p._current -= 1
+	return p.peek(0)
+}
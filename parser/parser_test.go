@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"toyscript/ast"
+	"toyscript/lexer"
+)
+
+func parse(t *testing.T, source string) ([]string, []Diagnostic) {
+	t.Helper()
+
+	tokens, err := lexer.NewScanner(source).ScanTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program, diagnostics := NewParser(tokens).Parse()
+	types := []string{}
+	for _, n := range program.Body {
+		types = append(types, n.Type())
+	}
+
+	return types, diagnostics
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"valid", `(@var (x 1)) (+ x 2)`, nil},
+		{"unexpected character", `(f ])`, []string{"1:4: unexpected character ']'"}},
+		{"unexpected non-ASCII", `(f é)`, []string{"1:4: unexpected character 'é'"}},
+		{"unterminated string", `(f "a`, []string{
+			"1:4: Unterminated string",
+			"1:6: expected ) in call expression (expected close-paren, found end-of-file)",
+		}},
+		{"every argument", `(f ] 1 [)`, []string{"1:4: unexpected character ']'", "1:8: unexpected character '['"}},
+		{"stray paren", `)`, []string{"1:1: unexpected ')' in statement"}},
+		{"atom in a form", `(1 2)`, []string{"1:2: unexpected '1' at the start of a form"}},
+		{"missing value", `(@var (y))`, []string{"1:9: unexpected ')' in expression"}},
+		{"empty match", `(@match)`, []string{"1:8: unexpected ')' in expression"}},
+		{"unclosed call", `(f 1`, []string{"1:5: expected ) in call expression (expected close-paren, found end-of-file)"}},
+		{"func params", `(@func a b)`, []string{"1:8: expected params list for func declaration (expected open-paren, found identifier)"}},
+		{"hash key", `(@hash (1 2))`, []string{"1:9: key must be a string (expected string, found number)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diagnostics := parse(t, tt.source)
+
+			got := []string{}
+			for _, d := range diagnostics {
+				got = append(got, d.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	source := strings.Join([]string{
+		`(@var (a 1))`,
+		`(f ])`,
+		`(@list 1 2)`,
+		`(@func x)`,
+		`(@match)`,
+		`(g (h [) 3)`,
+		`(a)`,
+	}, "\n")
+
+	types, diagnostics := parse(t, source)
+
+	want := []string{"2:4", "4:8", "5:8", "6:7"}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("got %d diagnostics %v, want %d", len(diagnostics), diagnostics, len(want))
+	}
+	for idx, d := range diagnostics {
+		if got := d.Span.Start.String(); got != want[idx] {
+			t.Errorf("diagnostic %d at %s, want %s: %s", idx, got, want[idx], d)
+		}
+	}
+
+	// NOTE: the forms around the malformed ones are still parsed,
+	// a call keeps its malformed args
+	wantTypes := "VarStatement CallExpression ListLiteral MalformedExpression MatchExpression CallExpression CallExpression"
+	if got := strings.Join(types, " "); got != wantTypes {
+		t.Errorf("got  %s\nwant %s", got, wantTypes)
+	}
+}
+
+func TestMalformedError(t *testing.T) {
+	tokens, _ := lexer.NewScanner(`(f ])`).ScanTokens()
+	program, diagnostics := NewParser(tokens).Parse()
+
+	// NOTE: the malformed node carries the message of its diagnostic
+	m := program.Body[0].(*ast.CallExpression).Args[0].(*ast.MalformedExpression)
+	if m.Error.Error() != diagnostics[0].Message {
+		t.Errorf("got %q, want %q", m.Error, diagnostics[0].Message)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	_, err := ParseSource("bad.toy", "(@var (x 1))\n(f ])\n")
+
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+	if syntaxErr.Filename != "bad.toy" || len(syntaxErr.Diagnostics) != 1 {
+		t.Errorf("got %s with %v", syntaxErr.Filename, syntaxErr.Diagnostics)
+	}
+
+	want := strings.Join([]string{
+		"bad.toy:2:4: error: unexpected character ']'",
+		"   2 | (f ])",
+		"     |    ^",
+	}, "\n")
+	if !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("got\n%s\nwant\n%s", err, want)
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	program, err := ParseInput("<stdin>", `x 1 "a" stdio.print (f x)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := []string{}
+	for _, n := range program.Body {
+		types = append(types, n.Type())
+	}
+	want := "ReferenceExpression NumberLiteral StringLiteral ReferenceExpression CallExpression"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	if _, err := ParseInput("<stdin>", `x )`); err == nil {
+		t.Error("expected the ) to be reported")
+	}
+	if _, err := ParseSource("script.toy", `x`); err == nil {
+		t.Error("expected atoms to be rejected in scripts")
+	}
+}
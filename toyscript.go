@@ -0,0 +1,130 @@
+// Package toyscript embeds toy-script in go programs.
+//
+//	rt := toyscript.New(toyscript.Options{
+//		Globals: map[string]any{"limit": 10},
+//		Funcs: map[string]toyscript.Func{
+//			"double": func(args ...any) (any, error) { return args[0].(int) * 2, nil },
+//		},
+//	})
+//	v, err := rt.Eval(ctx, `(double limit)`)
+//
+// the lexer, ast, parser and interpreter packages expose the stages on their own
+package toyscript
+
+import (
+	"context"
+	"sync"
+
+	"toyscript/interpreter"
+	"toyscript/parser"
+)
+
+type (
+	// Func is a go func callable from scripts,
+	// a returned error is raised in the script and can be caught by a @try
+	Func = func(args ...any) (any, error)
+
+	// Options configure a Runtime, the zero value runs on the tree-walking interpreter
+	Options struct {
+		// Engine is interpreter.ENGINE_TREE or interpreter.ENGINE_VM
+		Engine string
+		// Globals are bound before the first script runs
+		Globals map[string]any
+		// Funcs are bound as globals callable from scripts
+		Funcs map[string]Func
+		// Filename is reported in syntax errors and imports are resolved relative to it,
+		// the working dir is used when it's empty
+		Filename string
+	}
+
+	// Runtime evaluates sources one after the other,
+	// globals and imports are kept between evaluations
+	Runtime struct {
+		mu       sync.Mutex
+		engine   interpreter.Engine
+		err      error
+		filename string
+	}
+
+	// Error is a runtime error raised by a script, with its traceback
+	Error = interpreter.Error
+
+	// CaughtError is the value of a @catch, returned when a script returns it
+	CaughtError = interpreter.CaughtError
+
+	// SyntaxError is returned for sources which failed to parse
+	SyntaxError = parser.SyntaxError
+)
+
+// New creates a Runtime, an unknown engine is reported by every Eval
+func New(opts Options) *Runtime {
+	if opts.Engine == "" {
+		opts.Engine = interpreter.ENGINE_TREE
+	}
+
+	engine, err := interpreter.NewEngine(opts.Engine)
+	r := &Runtime{engine: engine, err: err, filename: opts.Filename}
+	if err != nil {
+		return r
+	}
+
+	for name, v := range opts.Globals {
+		r.Set(name, v)
+	}
+	for name, fn := range opts.Funcs {
+		r.Register(name, fn)
+	}
+
+	return r
+}
+
+// Eval parses and runs src and returns the value of its last expression.
+// Once ctx is done the script stops at its next func call, or while it waits on a stream,
+// with ctx.Err(). The go routines it leaves running keep ctx
+func (r *Runtime) Eval(ctx context.Context, src string) (any, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	filename := r.filename
+	if filename == "" {
+		filename = "<eval>"
+	}
+
+	program, err := parser.ParseSource(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.engine.Run(ctx, r.filename, program)
+}
+
+// Register binds fn as a global func callable from scripts
+func (r *Runtime) Register(name string, fn Func) {
+	r.Set(name, interpreter.Native(fn))
+}
+
+// Set binds a global value visible to the scripts evaluated afterwards
+func (r *Runtime) Set(name string, v any) {
+	if r.err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.engine.Define(name, v)
+}
+
+// RegisterModule makes funcs importable by path from every Runtime
+func RegisterModule(path string, funcs map[string]Func) {
+	members := make(map[string]func(a ...any) any, len(funcs))
+	for name, fn := range funcs {
+		members[name] = interpreter.Native(fn)
+	}
+
+	interpreter.RegisterModule(path, members)
+}
@@ -0,0 +1,71 @@
+package toyscript
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"toyscript/interpreter"
+)
+
+func TestCancelAfterEval(t *testing.T) {
+	for _, engine := range []string{interpreter.ENGINE_TREE, interpreter.ENGINE_VM} {
+		t.Run(engine, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			rt := New(Options{Engine: engine})
+			v, err := rt.Eval(ctx, `
+				(@var (double (@func (x) ((* x 2)))) (in (@stream)))
+				(@list in (@map double in))`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streams := v.([]any)
+			in, out := streams[0].(chan any), streams[1].(chan any)
+
+			// NOTE: the @map go routine outlives Eval and keeps ctx,
+			// a later evaluation doesn't replace it
+			if _, err := rt.Eval(context.Background(), `(double 1)`); err != nil {
+				t.Fatal(err)
+			}
+			in <- 1
+			if got := <-out; got != 2 {
+				t.Fatalf("got %v, want 2", got)
+			}
+
+			cancel()
+			select {
+			case got, ok := <-out:
+				if ok {
+					t.Fatalf("got %v, want the stream to be closed", got)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("the @map go routine wasn't cancelled")
+			}
+
+			// NOTE: the funcs of the cancelled evaluation get the ctx of the later ones
+			v, err = rt.Eval(context.Background(), `(double 2)`)
+			if err != nil || v != 4 {
+				t.Fatalf("got %v %v, want 4", v, err)
+			}
+		})
+	}
+}
+
+func TestCancelBlockedScript(t *testing.T) {
+	for _, engine := range []string{interpreter.ENGINE_TREE, interpreter.ENGINE_VM} {
+		t.Run(engine, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			// NOTE: nobody pushes onto the stream, the script only stops with ctx
+			rt := New(Options{Engine: engine})
+			_, err := rt.Eval(ctx, `(@pull (@stream))`)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got %v, want the deadline", err)
+			}
+		})
+	}
+}